@@ -0,0 +1,349 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/rpc"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rupor-github/lemonade/lemon"
+	"github.com/rupor-github/lemonade/param"
+)
+
+// content larger than that is transferred in chunks when server supports it
+const chunkSize = 256 * 1024
+
+const progressInterval = 200 * time.Millisecond
+
+// largest pasted content client agrees to decompress, it is kept in memory. Replaceable for testing.
+var maxDecompressed int64 = 256 << 20
+
+// progress reports transfer progress on stderr.
+type progress struct {
+	what  string
+	total int // -1 when unknown
+	done  int
+	last  time.Time
+}
+
+func newProgress(c *lemon.CLI, what string, total int) *progress {
+	if !c.Progress {
+		return nil
+	}
+	return &progress{what: what, total: total}
+}
+
+func (p *progress) add(n int) {
+	if p == nil {
+		return
+	}
+	p.done += n
+	if now := time.Now(); now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.report("")
+	}
+}
+
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	p.report("\n")
+}
+
+func (p *progress) report(end string) {
+	if p.total > 0 {
+		fmt.Fprintf(os.Stderr, "\r%s: %d of %d bytes (%d%%)%s", p.what, p.done, p.total, p.done*100/p.total, end)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r%s: %d bytes%s", p.what, p.done, end)
+}
+
+// readHead reads no more than chunkSize bytes of copied content, reports if there is more to read.
+func readHead(r io.Reader) ([]byte, bool, error) {
+	buf := make([]byte, chunkSize)
+	n, err := io.ReadFull(r, buf)
+	switch err {
+	case nil:
+		return buf, true, nil
+	case io.EOF, io.ErrUnexpectedEOF:
+		return buf[:n], false, nil
+	default:
+		return nil, false, err
+	}
+}
+
+func mimeType(c *lemon.CLI) string {
+	if len(c.Type) == 0 {
+		return param.MIMEText
+	}
+	return c.Type
+}
+
+// copyChunked sends head followed by the rest of content in chunks. Server changes clipboard only after all of it
+// is received and checksum matches, so dropped connection leaves clipboard intact.
+func copyChunked(c *lemon.CLI, rc *rpc.Client, head []byte, rest io.Reader) (rer error) {
+
+	if useTyped(c) {
+		if err := requireTyped(c, rc); err != nil {
+			return err
+		}
+	}
+
+	size := lemon.InputSize(rest)
+	if size >= 0 {
+		size += len(head)
+	}
+	if info := c.ServerInfo(rc); info.MaxPayload > 0 && size > info.MaxPayload {
+		return fmt.Errorf("%w: copied content is %d bytes, server limit is %d bytes", lemon.ErrTooLarge, size, info.MaxPayload)
+	}
+
+	if c.Debug {
+		log.Printf("Client Clipboard.CopyBegin to %s:%d - '%s' selection '%s' %d size", c.Host, c.Port, c.Type, c.Selection, size)
+	}
+	defer func() {
+		if c.Debug && rer != nil {
+			log.Printf("Client chunked copy received error: '%s'", rer.Error())
+		}
+	}()
+
+	p := &param.TransferParam{
+		MIME:      mimeType(c),
+		Selection: c.Selection,
+		Size:      size,
+	}
+	p.Host, p.User = identity(c)
+
+	cw := &chunkWriter{rc: rc}
+	var (
+		dst io.Writer = cw
+		zw  io.WriteCloser
+	)
+	if compress(c, rc) && (size < 0 || size >= c.CompressThreshold) {
+		var err error
+		if zw, err = lemon.NewCompressor(cw, c.Compress); err != nil {
+			return err
+		}
+		dst, p.Compression = zw, strings.ToLower(c.Compress)
+	}
+
+	if err := rc.Call("Clipboard.CopyBegin", p, dummy); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	h := sha256.New()
+	pr := newProgress(c, "copy", size)
+	chunk, more, total := head, true, 0
+	for {
+		if len(chunk) > 0 {
+			if _, err := dst.Write(chunk); err != nil {
+				return err
+			}
+			h.Write(chunk)
+			total += len(chunk)
+			pr.add(len(chunk))
+		}
+		if !more {
+			break
+		}
+		var err error
+		if chunk, more, err = readHead(rest); err != nil {
+			return err
+		}
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+	if err := cw.flush(); err != nil {
+		return err
+	}
+	pr.finish()
+	if c.Debug && zw != nil {
+		lemon.LogCompression("compressed", p.Compression, total, cw.sent, time.Since(start))
+	}
+
+	if c.Debug {
+		log.Printf("Client Clipboard.CopyEnd to %s:%d", c.Host, c.Port)
+	}
+	return rc.Call("Clipboard.CopyEnd", hex.EncodeToString(h.Sum(nil)), dummy)
+}
+
+// chunkWriter sends everything written to it to server in "Clipboard.CopyChunk" calls.
+type chunkWriter struct {
+	rc   *rpc.Client
+	buf  bytes.Buffer
+	sent int
+}
+
+func (cw *chunkWriter) Write(p []byte) (int, error) {
+	cw.buf.Write(p)
+	for cw.buf.Len() >= chunkSize {
+		if err := cw.send(cw.buf.Next(chunkSize)); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (cw *chunkWriter) flush() error {
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	return cw.send(cw.buf.Next(cw.buf.Len()))
+}
+
+func (cw *chunkWriter) send(chunk []byte) error {
+	if err := cw.rc.Call("Clipboard.CopyChunk", chunk, dummy); err != nil {
+		return err
+	}
+	cw.sent += len(chunk)
+	return nil
+}
+
+// heldWriter collects pasted content until all of it is received and verified. Pasted text is transformed as
+// a whole - transforms could not be applied to separate chunks.
+type heldWriter struct {
+	c         *lemon.CLI
+	w         io.Writer
+	transform bool
+	buf       bytes.Buffer
+}
+
+func (hw *heldWriter) Write(p []byte) (int, error) {
+	return hw.buf.Write(p)
+}
+
+func (hw *heldWriter) flush() error {
+	if hw.transform {
+		_, err := io.WriteString(hw.w, hw.c.Transform(lemon.DirPaste, hw.buf.String()))
+		return err
+	}
+	_, err := hw.buf.WriteTo(hw.w)
+	return err
+}
+
+// pasteChunked receives clipboard content in chunks. Content is written out as it arrives only when it goes to
+// output file, which is not replaced unless checksum verified at the end matches. Otherwise nothing is written
+// until content is verified.
+func pasteChunked(c *lemon.CLI, rc *rpc.Client, w io.Writer) (rer error) {
+
+	if useTyped(c) {
+		if err := requireTyped(c, rc); err != nil {
+			return err
+		}
+	}
+	if c.Debug {
+		log.Printf("Client Clipboard.PasteBegin to %s:%d - '%s' selection '%s'", c.Host, c.Port, c.Type, c.Selection)
+	}
+	defer func() {
+		if c.Debug && rer != nil {
+			log.Printf("Client chunked paste received error: '%s'", rer.Error())
+		}
+	}()
+
+	p := &param.PasteTypedParam{Types: []string{mimeType(c)}, Selection: c.Selection}
+	if compress(c, rc) {
+		p.Compression = strings.ToLower(c.Compress)
+	}
+	var info param.TransferInfo
+	if err := rc.Call("Clipboard.PasteBegin", p, &info); err != nil {
+		return err
+	}
+	if c.Debug {
+		log.Printf("Client Clipboard.PasteBegin received '%s' %d size, compression '%s'", info.MIME, info.Size, info.Compression)
+	}
+
+	var hw *heldWriter
+	if transform := lemon.IsText(info.MIME) && c.HasTransforms(lemon.DirPaste); transform || len(c.Output) == 0 {
+		hw = &heldWriter{c: c, w: w, transform: transform}
+		w = hw
+	}
+	h := sha256.New()
+	w = io.MultiWriter(h, w)
+
+	// compressed content is decompressed as it arrives
+	var (
+		dst  = w
+		pw   *io.PipeWriter
+		done chan error
+		size int64
+	)
+	start := time.Now()
+	if lemon.IsCompressed(info.Compression) {
+		var pr *io.PipeReader
+		pr, pw = io.Pipe()
+		done = make(chan error, 1)
+		go func() {
+			r, err := lemon.NewDecompressor(pr, info.Compression)
+			if err == nil {
+				// do not let small compressed content expand without bound
+				size, err = io.Copy(w, io.LimitReader(r, maxDecompressed+1))
+				if err == nil && size > maxDecompressed {
+					err = fmt.Errorf("%w: decompressed content is larger than %d bytes", lemon.ErrTooLarge, maxDecompressed)
+				}
+			}
+			pr.CloseWithError(err)
+			done <- err
+		}()
+		defer pw.Close()
+		dst = pw
+	}
+
+	pr := newProgress(c, "paste", info.Size)
+	for received := 0; received < info.Size; {
+		var chunk []byte
+		if err := rc.Call("Clipboard.PasteChunk", chunkSize, &chunk); err != nil {
+			return err
+		}
+		if len(chunk) == 0 {
+			return fmt.Errorf("%w: %d of %d bytes received", lemon.ErrChecksum, received, info.Size)
+		}
+		received += len(chunk)
+		if _, err := dst.Write(chunk); err != nil {
+			return err
+		}
+		pr.add(len(chunk))
+	}
+	pr.finish()
+
+	if pw != nil {
+		pw.Close()
+		if err := <-done; err != nil {
+			return fmt.Errorf("unable to decompress %s content: %w", info.Compression, err)
+		}
+		if c.Debug {
+			lemon.LogCompression("decompressed", info.Compression, int(size), info.Size, time.Since(start))
+		}
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != info.Hash {
+		return lemon.ErrChecksum
+	}
+	if hw != nil {
+		return hw.flush()
+	}
+	return nil
+}
+
+// compress checks if content exchanged with server should be compressed.
+func compress(c *lemon.CLI, rc *rpc.Client) bool {
+	return lemon.IsCompressed(c.Compress) && c.ServerInfo(rc).Has(param.CapCompress)
+}
+
+// readRest reads remaining copied content for calls requiring all of it at once.
+func readRest(text string, rest io.Reader) (string, error) {
+	var b bytes.Buffer
+	b.WriteString(text)
+	if _, err := b.ReadFrom(rest); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
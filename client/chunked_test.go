@@ -0,0 +1,45 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/rupor-github/lemonade/lemon"
+	"github.com/rupor-github/lemonade/param"
+)
+
+func TestPasteDecompressionLimit(t *testing.T) {
+
+	srv := startSyncServer(t)
+	defer srv.close()
+	text := strings.Repeat("0", 2*chunkSize)
+	srv.copy(t, text)
+
+	c := lemon.New()
+	c.Host = "127.0.0.1"
+	c.Port = srv.ln.Addr().(*net.TCPAddr).Port
+	c.Compress = param.CompressionGzip
+
+	var buf bytes.Buffer
+	if err := Paste(c, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != text {
+		t.Errorf("Expected %d bytes to be pasted, but got %d", len(text), buf.Len())
+	}
+
+	saved := maxDecompressed
+	maxDecompressed = chunkSize
+	defer func() { maxDecompressed = saved }()
+
+	buf.Reset()
+	if err := Paste(c, &buf); !errors.Is(err, lemon.ErrTooLarge) {
+		t.Errorf("Expected content expanding above limit to be rejected, but got '%v'", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing to be written when paste fails, but got %d bytes", buf.Len())
+	}
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -10,11 +11,13 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rupor-github/lemonade/lemon"
+	"github.com/rupor-github/lemonade/misc"
 	"github.com/rupor-github/lemonade/param"
 )
 
@@ -232,30 +235,76 @@ func Open(c *lemon.CLI) error {
 	return nil
 }
 
-// Paste implements client "paste" command.
-func Paste(c *lemon.CLI) (string, error) {
+// Paste implements client "paste" command writing clipboard content to w.
+func Paste(c *lemon.CLI, w io.Writer) error {
 
-	var resp string
+	if lemon.IsText(c.Type) {
+		ew := c.EncodeOutput(w)
+		if err := paste(c, ew); err != nil {
+			return err
+		}
+		return ew.Close()
+	}
+	return paste(c, w)
+}
 
-	err := c.ProcessRPC(func(rc *rpc.Client) (rer error) {
-		if c.Debug {
-			log.Printf("Client Clipboard.Paste to %s:%d", c.Host, c.Port)
+// PasteFile implements client "paste --output" command, output file is left intact unless paste succeeds.
+func PasteFile(c *lemon.CLI) error {
+
+	out, err := lemon.CreateOutput(c.Output, c.Append, c.OutputPerm)
+	if err != nil {
+		return err
+	}
+	if err := Paste(c, out); err != nil {
+		out.Abort()
+		return err
+	}
+	if c.Debug {
+		log.Printf("Client pasted to '%s'", c.Output)
+	}
+	return out.Commit()
+}
+
+func paste(c *lemon.CLI, w io.Writer) error {
+
+	return c.ProcessRPC(func(rc *rpc.Client) error {
+		if c.ServerInfo(rc).Has(param.CapChunked) {
+			return pasteChunked(c, rc, w)
 		}
-		defer func() {
-			if c.Debug {
-				if rer == nil {
-					log.Printf("Client Clipboard.Paste received %d length", len(resp))
-				} else {
-					log.Printf("Client Clipboard.Paste received error: '%s'", rer.Error())
-				}
-			}
-		}()
-		return rc.Call("Clipboard.Paste", dummy, &resp)
+		text, err := pasteOnce(c, rc)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, text)
+		return err
 	})
-	if err != nil {
+}
+
+// pasteOnce gets clipboard content in a single call from servers without chunked transfer support.
+func pasteOnce(c *lemon.CLI, rc *rpc.Client) (string, error) {
+
+	if useTyped(c) {
+		data, err := pasteTyped(c, rc)
+		if err != nil || !lemon.IsText(c.Type) {
+			return string(data), err
+		}
+		return c.Transform(lemon.DirPaste, string(data)), nil
+	}
+
+	if c.Debug {
+		log.Printf("Client Clipboard.Paste to %s:%d", c.Host, c.Port)
+	}
+	var resp string
+	if err := rc.Call("Clipboard.Paste", dummy, &resp); err != nil {
+		if c.Debug {
+			log.Printf("Client Clipboard.Paste received error: '%s'", err.Error())
+		}
 		return "", err
 	}
-	return c.ConvertLineEnding(resp), nil
+	if c.Debug {
+		log.Printf("Client Clipboard.Paste received %d length", len(resp))
+	}
+	return c.Transform(lemon.DirPaste, resp), nil
 }
 
 // Copy implements client "copy" command.
@@ -263,7 +312,67 @@ func Copy(c *lemon.CLI) error {
 
 	text := c.DataSource
 
-	return c.ProcessRPC(func(rc *rpc.Client) (rer error) {
+	// only content which does not fit into single chunk is left in rest
+	var rest io.Reader
+	if c.DataReader != nil {
+		r := c.DataReader
+		if lemon.IsText(c.Type) {
+			r = c.DecodeInput(r)
+		}
+		head, more, err := readHead(r)
+		if err != nil {
+			return err
+		}
+		text = string(head)
+		if more {
+			rest = r
+		}
+	}
+
+	if lemon.IsText(c.Type) && c.HasTransforms(lemon.DirSend) {
+		// transforms need all of the text at once
+		if rest != nil {
+			var err error
+			if text, err = readRest(text, rest); err != nil {
+				return err
+			}
+			rest = nil
+		}
+		text = c.Transform(lemon.DirSend, text)
+		if len(text) > chunkSize {
+			text, rest = text[:chunkSize], strings.NewReader(text[chunkSize:])
+		}
+	}
+
+	if c.OSC52 {
+		if rest != nil {
+			var err error
+			if text, err = readRest(text, rest); err != nil {
+				return err
+			}
+		}
+		return copyOSC52(c, text)
+	}
+
+	err := c.ProcessRPC(func(rc *rpc.Client) (rer error) {
+		if rest != nil {
+			if c.ServerInfo(rc).Has(param.CapChunked) {
+				return copyChunked(c, rc, []byte(text), rest)
+			}
+			var err error
+			if text, err = readRest(text, rest); err != nil {
+				return err
+			}
+			rest = nil
+		}
+		// do not bother sending what server is going to reject anyways
+		if info := c.ServerInfo(rc); info.MaxPayload > 0 && len(text) > info.MaxPayload {
+			return fmt.Errorf("%w: copied text is %d bytes, server limit is %d bytes", lemon.ErrTooLarge, len(text), info.MaxPayload)
+		}
+		// servers keeping clipboard metadata learn who copied text from typed call
+		if useTyped(c) || compress(c, rc) && len(text) >= c.CompressThreshold || c.ReportIdentity && c.ServerInfo(rc).Has(param.CapStat) {
+			return copyTyped(c, rc, []byte(text))
+		}
 		if c.Debug {
 			log.Printf("Client Clipboard.Copy to %s:%d - %d length", c.Host, c.Port, len(text))
 		}
@@ -274,4 +383,43 @@ func Copy(c *lemon.CLI) error {
 		}()
 		return rc.Call("Clipboard.Copy", text, dummy)
 	})
+	if err != nil && c.OSC52Fallback && isUnreachable(err) {
+		if c.Debug {
+			log.Printf("Client unable to reach server, falling back to OSC 52: %s", err.Error())
+		}
+		if rest != nil {
+			if text, err = readRest(text, rest); err != nil {
+				return err
+			}
+		}
+		return copyOSC52(c, text)
+	}
+	return err
+}
+
+// Version implements client "version" command.
+func Version(c *lemon.CLI) error {
+
+	fmt.Printf("lemonade %s (%s/%s, %s) %s\n", misc.GetVersion(), runtime.GOOS, runtime.GOARCH, runtime.Version(), lemon.LastGitCommit)
+	if !c.Remote {
+		return nil
+	}
+
+	return c.ProcessRPC(func(rc *rpc.Client) error {
+		info := c.ServerInfo(rc)
+		if info.ProtocolVersion == 0 {
+			fmt.Println("server: legacy, no information available")
+			return nil
+		}
+		fmt.Printf("server: lemonade %s (%s/%s)\n", info.Version, info.OS, info.Arch)
+		fmt.Printf("protocol: %d\n", info.ProtocolVersion)
+		fmt.Printf("capabilities: %s\n", strings.Join(info.Capabilities, ","))
+		if len(info.LineEnding) > 0 {
+			fmt.Printf("line ending: %s\n", info.LineEnding)
+		}
+		if info.MaxPayload > 0 {
+			fmt.Printf("max payload: %d\n", info.MaxPayload)
+		}
+		return nil
+	})
 }
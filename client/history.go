@@ -0,0 +1,76 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/rpc"
+	"strconv"
+	"strings"
+
+	"github.com/rupor-github/lemonade/lemon"
+	"github.com/rupor-github/lemonade/param"
+)
+
+// History implements client "history" command: lists server clipboard history, outputs or promotes single entry.
+func History(c *lemon.CLI) (string, error) {
+
+	index := -1
+	if len(c.DataSource) > 0 {
+		var err error
+		if index, err = strconv.Atoi(c.DataSource); err != nil || index < 0 {
+			return "", fmt.Errorf("bad history entry index '%s'", c.DataSource)
+		}
+	} else if c.Promote {
+		return "", errors.New("history entry index is required to promote it")
+	}
+
+	var resp string
+	err := c.ProcessRPC(func(rc *rpc.Client) (rer error) {
+		if !c.ServerInfo(rc).Has(param.CapHistory) {
+			return lemon.ErrHistoryDisabled
+		}
+		defer func() {
+			if c.Debug && rer != nil {
+				log.Printf("Client History received error: '%s'", rer.Error())
+			}
+		}()
+
+		switch {
+		case index < 0:
+			if c.Debug {
+				log.Printf("Client History.List to %s:%d", c.Host, c.Port)
+			}
+			var entries []param.HistoryEntry
+			if err := rc.Call("History.List", dummy, &entries); err != nil {
+				return err
+			}
+			resp = formatHistory(entries)
+			return nil
+		case c.Promote:
+			if c.Debug {
+				log.Printf("Client History.Promote %d to %s:%d", index, c.Host, c.Port)
+			}
+			return rc.Call("History.Promote", index, dummy)
+		default:
+			if c.Debug {
+				log.Printf("Client History.Get %d to %s:%d", index, c.Host, c.Port)
+			}
+			var e param.HistoryEntry
+			if err := rc.Call("History.Get", index, &e); err != nil {
+				return err
+			}
+			resp = c.Transform(lemon.DirPaste, e.Text)
+			return nil
+		}
+	})
+	return resp, err
+}
+
+func formatHistory(entries []param.HistoryEntry) string {
+	var buf strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&buf, "%3d  %s  %8d  %-15s  %s\n", e.Index, e.Time.Local().Format("2006-01-02 15:04:05"), e.Size, e.Source, e.Preview)
+	}
+	return buf.String()
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"runtime"
+
+	"github.com/rupor-github/lemonade/lemon"
+)
+
+func terminal() string {
+	if runtime.GOOS == "windows" {
+		return "CONOUT$"
+	}
+	return "/dev/tty"
+}
+
+// isUnreachable checks if error means there is no server to talk to.
+func isUnreachable(err error) bool {
+	var oe *net.OpError
+	return errors.As(err, &oe) && oe.Op == "dial"
+}
+
+// copyOSC52 asks terminal to set clipboard by writing OSC 52 escape sequence to it directly, so output redirection
+// does not matter.
+func copyOSC52(c *lemon.CLI, text string) error {
+
+	if !lemon.IsText(c.Type) {
+		return errors.New("only text could be copied using OSC 52")
+	}
+	// there is no server to convert line endings
+	seq, err := lemon.OSC52(lemon.ConvertLineEnding(text, c.LineEnding), c.Selection, c.OSC52MaxSize)
+	if err != nil {
+		return err
+	}
+
+	tty, err := os.OpenFile(terminal(), os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("unable to open terminal to copy using OSC 52: %w", err)
+	}
+	defer tty.Close()
+
+	if c.Debug {
+		log.Printf("Client OSC 52 copy - %d length, %d bytes sequence", len(text), len(seq))
+	}
+	_, err = tty.WriteString(seq)
+	return err
+}
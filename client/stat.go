@@ -0,0 +1,82 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/rpc"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/rupor-github/lemonade/lemon"
+	"github.com/rupor-github/lemonade/param"
+)
+
+// identity returns host and user names reported to server with copied content, nothing is reported unless asked for.
+func identity(c *lemon.CLI) (string, string) {
+	if !c.ReportIdentity {
+		return "", ""
+	}
+	host, _ := os.Hostname()
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	} else if len(name) == 0 {
+		name = os.Getenv("USERNAME")
+	}
+	return host, name
+}
+
+// Stat implements client "stat" command: describes server clipboard content.
+func Stat(c *lemon.CLI) (string, error) {
+
+	var resp string
+	err := c.ProcessRPC(func(rc *rpc.Client) error {
+		if !c.ServerInfo(rc).Has(param.CapStat) {
+			return errors.New("server does not support clipboard metadata")
+		}
+		if c.Debug {
+			log.Printf("Client Clipboard.Stat to %s:%d", c.Host, c.Port)
+		}
+		var st param.ClipboardStat
+		if err := rc.Call("Clipboard.Stat", dummy, &st); err != nil {
+			if c.Debug {
+				log.Printf("Client Clipboard.Stat received error: '%s'", err.Error())
+			}
+			return err
+		}
+		if !c.JSON {
+			resp = formatStat(&st)
+			return nil
+		}
+		b, err := json.MarshalIndent(&st, "", "  ")
+		if err != nil {
+			return err
+		}
+		resp = string(b) + "\n"
+		return nil
+	})
+	return resp, err
+}
+
+func formatStat(st *param.ClipboardStat) string {
+	source := st.Source
+	switch {
+	case len(st.User) > 0 && len(st.Host) > 0:
+		source += fmt.Sprintf(" (%s@%s)", st.User, st.Host)
+	case len(st.User)+len(st.Host) > 0:
+		source += fmt.Sprintf(" (%s)", st.User+st.Host)
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "source: %s\n", source)
+	fmt.Fprintf(&buf, "time: %s\n", st.Time.Local().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&buf, "bytes: %d\n", st.Size)
+	if lemon.IsText(st.MIME) {
+		fmt.Fprintf(&buf, "lines: %d\n", st.Lines)
+	}
+	fmt.Fprintf(&buf, "type: %s\n", st.MIME)
+	fmt.Fprintf(&buf, "hash: %s\n", st.Hash)
+	return buf.String()
+}
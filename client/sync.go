@@ -0,0 +1,273 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/rpc"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rupor-github/lemonade/lemon"
+	"github.com/rupor-github/lemonade/param"
+)
+
+const syncRetry = 5 * time.Second
+
+var errWatchUnsupported = errors.New("server does not support watching clipboard")
+
+// syncer keeps local clipboard in sync with server one. Loops are prevented by remembering hashes of content
+// known to be on both sides and by tagging changes pushed to server with origin, so they are not pulled back.
+// When both directions are synchronized server content takes precedence on start: it is pulled before local
+// changes are pushed.
+type syncer struct {
+	c      *lemon.CLI
+	local  lemon.ClipboardBackend
+	origin string
+	ready  chan struct{} // closed when pushing could start
+	once   sync.Once
+	stop   chan struct{} // closed to stop synchronization
+
+	mu         sync.Mutex
+	localHash  string // local clipboard text we have written or pushed
+	remoteHash string // server clipboard text we have pulled or pushed
+}
+
+func newSyncer(c *lemon.CLI, local lemon.ClipboardBackend) *syncer {
+	return &syncer{c: c, local: local, origin: newOrigin(), ready: make(chan struct{}), stop: make(chan struct{})}
+}
+
+func newOrigin() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%s/%d/%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+// Sync implements client "sync" command.
+func Sync(c *lemon.CLI) error {
+
+	local, err := lemon.NewBackend(c)
+	if err != nil {
+		return fmt.Errorf("unable to prepare local clipboard: %w", err)
+	}
+	s := newSyncer(c, local)
+	if c.Debug {
+		log.Printf("Client sync '%s' with %s:%d as '%s'", c.SyncDirection, c.Host, c.Port, s.origin)
+	}
+	return s.run(strings.ToLower(c.SyncDirection))
+}
+
+// run synchronizes clipboards in direction until either loop fails or syncer is stopped.
+func (s *syncer) run(dir string) error {
+
+	if dir != lemon.SyncPull && s.c.ClipboardPoll <= 0 {
+		return errors.New("clipboard poll interval is required to push local changes")
+	}
+
+	errs := make(chan error, 2)
+	if dir != lemon.SyncPush {
+		go func() { errs <- s.pullLoop() }()
+	} else {
+		s.setReady()
+	}
+	if dir != lemon.SyncPull {
+		go func() { errs <- s.pushLoop() }()
+	}
+	return <-errs
+}
+
+func (s *syncer) setReady() {
+	s.once.Do(func() { close(s.ready) })
+}
+
+func (s *syncer) pullLoop() error {
+	for {
+		err := s.c.ProcessRPC(s.pull)
+		select {
+		case <-s.stop:
+			return nil
+		default:
+		}
+		if errors.Is(err, lemon.ErrAuth) || errors.Is(err, errWatchUnsupported) {
+			return err
+		}
+		log.Printf("Client sync lost connection to server, retrying in %s: %v", syncRetry, err)
+		select {
+		case <-s.stop:
+			return nil
+		case <-time.After(syncRetry):
+		}
+	}
+}
+
+// pull waits for server clipboard changes applying them locally once clipboard stays unchanged for debounce period.
+func (s *syncer) pull(rc *rpc.Client) error {
+
+	if info := s.c.ServerInfo(rc); !info.Has(param.CapWatch) {
+		return fmt.Errorf("%w: server protocol version %d is too old, upgrade server or sync in '%s' direction only",
+			errWatchUnsupported, info.ProtocolVersion, lemon.SyncPush)
+	}
+
+	s.mu.Lock()
+	hash := s.remoteHash
+	s.mu.Unlock()
+
+	if len(hash) == 0 {
+		// server content is applied right away on start and only then local changes are pushed
+		var resp param.WatchResult
+		if err := rc.Call("Clipboard.Watch", &param.WatchParam{}, &resp); err != nil {
+			return err
+		}
+		if resp.Origin != s.origin {
+			s.apply(&resp)
+		}
+		hash = resp.Hash
+	}
+	s.setReady()
+
+	var pending *param.WatchResult
+	for {
+		var timeout time.Duration
+		if pending != nil {
+			timeout = s.c.SyncDebounce
+		}
+		var resp param.WatchResult
+		if err := rc.Call("Clipboard.Watch", &param.WatchParam{Hash: hash, Timeout: timeout}, &resp); err != nil {
+			return err
+		}
+		if resp.Changed {
+			hash = resp.Hash
+			if resp.Origin == s.origin {
+				// our own change came back
+				s.mu.Lock()
+				s.remoteHash = hash
+				s.mu.Unlock()
+				pending = nil
+				continue
+			}
+			pending = &resp
+			if s.c.SyncDebounce > 0 {
+				continue
+			}
+		}
+		if pending != nil {
+			s.apply(pending)
+			pending = nil
+		}
+	}
+}
+
+func (s *syncer) apply(r *param.WatchResult) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Hash == s.remoteHash {
+		return
+	}
+	text := s.c.Transform(lemon.DirPaste, r.Text)
+	if err := s.local.WriteAll(text); err != nil {
+		log.Printf("Client sync unable to set local clipboard: %s", err.Error())
+		return
+	}
+	s.remoteHash, s.localHash = r.Hash, lemon.HashText(text)
+	if s.c.Debug {
+		log.Printf("Client sync pulled %d length from server", len(text))
+	}
+}
+
+// pushLoop checks local clipboard periodically sending changes to server once clipboard stays unchanged for debounce
+// period.
+func (s *syncer) pushLoop() error {
+
+	select {
+	case <-s.ready:
+	case <-s.stop:
+		return nil
+	}
+
+	ticker := time.NewTicker(s.c.ClipboardPoll)
+	defer ticker.Stop()
+
+	var (
+		pending string
+		since   time.Time
+	)
+	for {
+		select {
+		case <-s.stop:
+			return nil
+		case <-ticker.C:
+		}
+		text, err := s.local.ReadAll()
+		if err != nil {
+			if s.c.Debug {
+				log.Printf("Client sync unable to read local clipboard: %s", err.Error())
+			}
+			continue
+		}
+		hash := lemon.HashText(text)
+
+		s.mu.Lock()
+		known := hash == s.localHash
+		s.mu.Unlock()
+		if known {
+			pending = ""
+			continue
+		}
+		if hash != pending {
+			pending, since = hash, time.Now()
+		}
+		if time.Since(since) < s.c.SyncDebounce {
+			continue
+		}
+
+		if err := s.push(text, hash); err != nil {
+			if errors.Is(err, lemon.ErrAuth) {
+				return err
+			}
+			log.Printf("Client sync unable to push to server: %s", err.Error())
+			var se rpc.ServerError
+			if !errors.As(err, &se) || strings.HasPrefix(se.Error(), lemon.ErrRateLimited.Error()) {
+				continue
+			}
+			// server refused content itself, pushing it again would not help
+			s.mu.Lock()
+			s.localHash = hash
+			s.mu.Unlock()
+		}
+		pending = ""
+	}
+}
+
+func (s *syncer) push(text, hash string) error {
+
+	p := &param.CopyTypedParam{
+		Formats: []param.ClipboardFormat{{MIME: param.MIMEText, Data: []byte(text)}},
+		Origin:  s.origin,
+	}
+	p.Host, p.User = identity(s.c)
+	if err := s.c.ProcessRPC(func(rc *rpc.Client) error {
+		if !s.c.ServerInfo(rc).Has(param.CapWatch) {
+			// server predating watching could not tell our changes apart, which only matters when pulling
+			return rc.Call("Clipboard.Copy", text, dummy)
+		}
+		return rc.Call("Clipboard.CopyTyped", p, dummy)
+	}); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.localHash = hash
+	s.mu.Unlock()
+
+	if s.c.Debug {
+		log.Printf("Client sync pushed %d length to server", len(text))
+	}
+	return nil
+}
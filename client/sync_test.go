@@ -0,0 +1,351 @@
+package client
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rupor-github/lemonade/lemon"
+)
+
+// recordingBackend remembers every text written to clipboard.
+type recordingBackend struct {
+	lemon.ClipboardBackend
+
+	mu     sync.Mutex
+	writes []string
+}
+
+func newRecordingBackend(t *testing.T) *recordingBackend {
+	t.Helper()
+	c := lemon.New()
+	c.Backend = lemon.BackendMemory
+	b, err := lemon.NewBackend(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &recordingBackend{ClipboardBackend: b}
+}
+
+func (b *recordingBackend) WriteAll(text string) error {
+	b.mu.Lock()
+	b.writes = append(b.writes, text)
+	b.mu.Unlock()
+	return b.ClipboardBackend.WriteAll(text)
+}
+
+func (b *recordingBackend) written() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string{}, b.writes...)
+}
+
+// syncServer serves rpc on loopback with recording clipboard.
+type syncServer struct {
+	svc   *lemon.Service
+	clip  *recordingBackend
+	ln    net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func startSyncServer(t *testing.T) *syncServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &syncServer{clip: newRecordingBackend(t), ln: ln}
+	c := lemon.New()
+	c.ClipboardPoll = 0
+	s.svc = lemon.NewService(c, s.clip)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go func() { _ = s.svc.ServeConn(conn, lemon.CodecGob) }()
+		}
+	}()
+	return s
+}
+
+func (s *syncServer) close() {
+	s.ln.Close()
+	s.svc.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// copy changes server clipboard as another client would.
+func (s *syncServer) copy(t *testing.T, text string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := rpc.NewClient(conn)
+	defer rc.Close()
+	if err := rc.Call("Clipboard.Copy", text, dummy); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func syncCLI(ln net.Listener) *lemon.CLI {
+	c := lemon.New()
+	c.Host = "127.0.0.1"
+	c.Port = ln.Addr().(*net.TCPAddr).Port
+	c.ClipboardPoll = 10 * time.Millisecond
+	c.SyncDebounce = 200 * time.Millisecond
+	return c
+}
+
+func startSyncer(t *testing.T, srv *syncServer, local *recordingBackend, dir string) func() {
+	t.Helper()
+	s := newSyncer(syncCLI(srv.ln), local)
+	done := make(chan error, 1)
+	go func() { done <- s.run(dir) }()
+	return func() {
+		close(s.stop)
+		srv.close()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Unexpected sync error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Sync did not stop")
+		}
+	}
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSyncServerFirst(t *testing.T) {
+
+	srv := startSyncServer(t)
+	srv.copy(t, "server")
+	local := newRecordingBackend(t)
+	_ = local.ClipboardBackend.WriteAll("local")
+
+	stop := startSyncer(t, srv, local, lemon.SyncBoth)
+	defer stop()
+
+	eventually(t, "server content to be pulled", func() bool { return equal(local.written(), []string{"server"}) })
+	// give push loop a chance to misbehave
+	time.Sleep(400 * time.Millisecond)
+	if w := srv.clip.written(); !equal(w, []string{"server"}) {
+		t.Errorf("Expected local content not to be pushed on start, but server got %q", w)
+	}
+}
+
+func TestSyncNoEcho(t *testing.T) {
+
+	srv := startSyncServer(t)
+	srv.copy(t, "start")
+	local := newRecordingBackend(t)
+
+	stop := startSyncer(t, srv, local, lemon.SyncBoth)
+	defer stop()
+	eventually(t, "server content to be pulled", func() bool { return len(local.written()) == 1 })
+
+	_ = local.ClipboardBackend.WriteAll("mine")
+	eventually(t, "local change to be pushed", func() bool { return equal(srv.clip.written(), []string{"start", "mine"}) })
+	time.Sleep(400 * time.Millisecond)
+	if w := local.written(); !equal(w, []string{"start"}) {
+		t.Errorf("Expected pushed change not to be pulled back, but local clipboard got %q", w)
+	}
+	if w := srv.clip.written(); !equal(w, []string{"start", "mine"}) {
+		t.Errorf("Expected change to be pushed once, but server got %q", w)
+	}
+}
+
+func TestSyncDebounce(t *testing.T) {
+
+	srv := startSyncServer(t)
+	srv.copy(t, "start")
+	local := newRecordingBackend(t)
+
+	stop := startSyncer(t, srv, local, lemon.SyncBoth)
+	defer stop()
+	eventually(t, "server content to be pulled", func() bool { return len(local.written()) == 1 })
+
+	// rapid server changes are pulled as one
+	for _, text := range []string{"one", "two", "three"} {
+		srv.copy(t, text)
+		time.Sleep(20 * time.Millisecond)
+	}
+	eventually(t, "server changes to be pulled", func() bool { return len(local.written()) > 1 })
+	time.Sleep(400 * time.Millisecond)
+	if w := local.written(); !equal(w, []string{"start", "three"}) {
+		t.Errorf("Expected server changes to be coalesced, but local clipboard got %q", w)
+	}
+
+	// rapid local changes are pushed as one
+	before := len(srv.clip.written())
+	for _, text := range []string{"a", "b", "c"} {
+		_ = local.ClipboardBackend.WriteAll(text)
+		time.Sleep(30 * time.Millisecond)
+	}
+	eventually(t, "local changes to be pushed", func() bool { return len(srv.clip.written()) > before })
+	time.Sleep(400 * time.Millisecond)
+	if w := srv.clip.written()[before:]; !equal(w, []string{"c"}) {
+		t.Errorf("Expected local changes to be coalesced, but server got %q", w)
+	}
+}
+
+func TestSyncDirections(t *testing.T) {
+
+	// push only never changes local clipboard
+	srv := startSyncServer(t)
+	srv.copy(t, "server")
+	local := newRecordingBackend(t)
+	_ = local.ClipboardBackend.WriteAll("local")
+	stop := startSyncer(t, srv, local, lemon.SyncPush)
+	eventually(t, "local content to be pushed", func() bool { return equal(srv.clip.written(), []string{"server", "local"}) })
+	srv.copy(t, "changed")
+	time.Sleep(400 * time.Millisecond)
+	if w := local.written(); len(w) != 0 {
+		t.Errorf("Expected push only sync not to change local clipboard, but got %q", w)
+	}
+	stop()
+
+	// pull only never changes server clipboard
+	srv = startSyncServer(t)
+	srv.copy(t, "server")
+	local = newRecordingBackend(t)
+	stop = startSyncer(t, srv, local, lemon.SyncPull)
+	eventually(t, "server content to be pulled", func() bool { return equal(local.written(), []string{"server"}) })
+	_ = local.ClipboardBackend.WriteAll("local")
+	srv.copy(t, "changed")
+	eventually(t, "server change to be pulled", func() bool { return equal(local.written(), []string{"server", "changed"}) })
+	if w := srv.clip.written(); !equal(w, []string{"server", "changed"}) {
+		t.Errorf("Expected pull only sync not to change server clipboard, but got %q", w)
+	}
+	stop()
+}
+
+// legacyClipboard serves rpc as servers without "Server.Info" do, it keeps text only.
+type legacyClipboard struct {
+	mu     sync.Mutex
+	text   string
+	calls  int
+	reject bool
+}
+
+func (l *legacyClipboard) Copy(text string, _ *struct{}) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls++
+	if l.reject {
+		return errors.New("rejected")
+	}
+	l.text = text
+	return nil
+}
+
+func (l *legacyClipboard) Paste(_ struct{}, resp *string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*resp = l.text
+	return nil
+}
+
+func (l *legacyClipboard) state() (string, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.text, l.calls
+}
+
+func startLegacyServer(t *testing.T, l *legacyClipboard) net.Listener {
+	t.Helper()
+	rs := rpc.NewServer()
+	if err := rs.RegisterName("Clipboard", l); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go rs.Accept(ln)
+	return ln
+}
+
+func TestSyncLegacyServer(t *testing.T) {
+
+	// pulling needs watching, it fails at once
+	l := &legacyClipboard{}
+	ln := startLegacyServer(t, l)
+	defer ln.Close()
+	done := make(chan error, 1)
+	go func() { done <- newSyncer(syncCLI(ln), newRecordingBackend(t)).run(lemon.SyncBoth) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errWatchUnsupported) || !strings.Contains(err.Error(), "version 0") {
+			t.Errorf("Expected '%s' error with server version, but got '%v'", errWatchUnsupported, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected sync with legacy server to fail")
+	}
+
+	// pushing falls back to plain text copy
+	local := newRecordingBackend(t)
+	_ = local.ClipboardBackend.WriteAll("local")
+	s := newSyncer(syncCLI(ln), local)
+	go func() { done <- s.run(lemon.SyncPush) }()
+	eventually(t, "local content to be pushed", func() bool { text, _ := l.state(); return text == "local" })
+	close(s.stop)
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected sync error: %v", err)
+	}
+
+	// content refused by server is not pushed over and over
+	l = &legacyClipboard{reject: true}
+	ln = startLegacyServer(t, l)
+	defer ln.Close()
+	s = newSyncer(syncCLI(ln), local)
+	go func() { done <- s.run(lemon.SyncPush) }()
+	eventually(t, "local content to be pushed", func() bool { _, calls := l.state(); return calls > 0 })
+	time.Sleep(400 * time.Millisecond)
+	if _, calls := l.state(); calls != 1 {
+		t.Errorf("Expected refused content to be pushed once, but it was pushed %d times", calls)
+	}
+	_ = local.ClipboardBackend.WriteAll("changed")
+	eventually(t, "local change to be pushed", func() bool { _, calls := l.state(); return calls == 2 })
+	close(s.stop)
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected sync error: %v", err)
+	}
+}
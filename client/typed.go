@@ -0,0 +1,80 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"net/rpc"
+
+	"github.com/rupor-github/lemonade/lemon"
+	"github.com/rupor-github/lemonade/param"
+)
+
+// useTyped checks if request could not be expressed with plain text calls.
+func useTyped(c *lemon.CLI) bool {
+	return !lemon.IsText(c.Type) || lemon.IsPrimary(c.Selection)
+}
+
+func requireTyped(c *lemon.CLI, rc *rpc.Client) error {
+	info := c.ServerInfo(rc)
+	if lemon.IsPrimary(c.Selection) && !info.Has(param.CapSelection) {
+		return lemon.ErrSelectionUnsupported
+	}
+	if !info.Has(param.CapTyped) {
+		return fmt.Errorf("server does not support typed clipboard content, unable to use '%s'", c.Type)
+	}
+	return nil
+}
+
+// copyTyped is also used for plain text to send it compressed.
+func copyTyped(c *lemon.CLI, rc *rpc.Client, data []byte) (rer error) {
+
+	if useTyped(c) {
+		if err := requireTyped(c, rc); err != nil {
+			return err
+		}
+	}
+	f := param.ClipboardFormat{MIME: c.Type, Data: data}
+	if compress(c, rc) {
+		var err error
+		if f.Data, f.Compression, err = lemon.Compress(data, c.Compress, c.CompressThreshold, c.Debug); err != nil {
+			return err
+		}
+	}
+	if c.Debug {
+		log.Printf("Client Clipboard.CopyTyped to %s:%d - '%s' selection '%s' %d length", c.Host, c.Port, c.Type, c.Selection, len(data))
+	}
+	defer func() {
+		if c.Debug && rer != nil {
+			log.Printf("Client Clipboard.CopyTyped received error: '%s'", rer.Error())
+		}
+	}()
+
+	p := &param.CopyTypedParam{
+		Formats:   []param.ClipboardFormat{f},
+		Selection: c.Selection,
+	}
+	p.Host, p.User = identity(c)
+	return rc.Call("Clipboard.CopyTyped", p, dummy)
+}
+
+func pasteTyped(c *lemon.CLI, rc *rpc.Client) ([]byte, error) {
+
+	if err := requireTyped(c, rc); err != nil {
+		return nil, err
+	}
+	if c.Debug {
+		log.Printf("Client Clipboard.PasteTyped to %s:%d - '%s' selection '%s'", c.Host, c.Port, c.Type, c.Selection)
+	}
+
+	var resp param.ClipboardFormat
+	if err := rc.Call("Clipboard.PasteTyped", &param.PasteTypedParam{Types: []string{c.Type}, Selection: c.Selection}, &resp); err != nil {
+		if c.Debug {
+			log.Printf("Client Clipboard.PasteTyped received error: '%s'", err.Error())
+		}
+		return nil, err
+	}
+	if c.Debug {
+		log.Printf("Client Clipboard.PasteTyped received '%s' %d length", resp.MIME, len(resp.Data))
+	}
+	return resp.Data, nil
+}
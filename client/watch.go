@@ -0,0 +1,79 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/rpc"
+	"os"
+	"strconv"
+
+	"github.com/rupor-github/lemonade/lemon"
+	"github.com/rupor-github/lemonade/param"
+)
+
+// HashEnv is set to clipboard hash for command run on clipboard change.
+const HashEnv = "LEMONADE_HASH"
+
+// Watch implements client "paste --watch" command.
+func Watch(c *lemon.CLI) error {
+
+	if !lemon.IsText(c.Type) || lemon.IsPrimary(c.Selection) {
+		return errors.New("only clipboard text could be watched")
+	}
+	sep, err := strconv.Unquote(`"` + c.WatchSeparator + `"`)
+	if err != nil {
+		sep = c.WatchSeparator
+	}
+
+	return c.ProcessRPC(func(rc *rpc.Client) error {
+		if !c.ServerInfo(rc).Has(param.CapWatch) {
+			return errors.New("server does not support watching clipboard")
+		}
+		if c.Debug {
+			log.Printf("Client Clipboard.Watch to %s:%d", c.Host, c.Port)
+		}
+
+		// the whole output is a single stream in requested encoding
+		stdout := c.EncodeOutput(os.Stdout)
+		defer stdout.Close()
+
+		var hash string
+		for {
+			var resp param.WatchResult
+			if err := rc.Call("Clipboard.Watch", &param.WatchParam{Hash: hash, HashOnly: c.WatchHash}, &resp); err != nil {
+				return err
+			}
+			if !resp.Changed {
+				continue
+			}
+			hash = resp.Hash
+			if c.Debug {
+				log.Printf("Client Clipboard.Watch received %d length, hash %s", len(resp.Text), resp.Hash)
+			}
+
+			out := resp.Hash
+			if !c.WatchHash {
+				out = c.Transform(lemon.DirPaste, resp.Text)
+			}
+			if len(c.WatchExec) == 0 {
+				if _, err := fmt.Fprint(stdout, out+sep); err != nil {
+					return err
+				}
+				continue
+			}
+			data, err := c.EncodeText(out)
+			if err != nil {
+				return err
+			}
+			cmd := lemon.ShellCommand(c.WatchExec)
+			cmd.Stdin = bytes.NewReader(data)
+			cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+			cmd.Env = append(os.Environ(), HashEnv+"="+resp.Hash)
+			if err := cmd.Run(); err != nil {
+				log.Printf("Client Clipboard.Watch command '%s' failed: %s", c.WatchExec, err.Error())
+			}
+		}
+	})
+}
@@ -3,7 +3,7 @@ module github.com/rupor-github/lemonade
 go 1.13
 
 require (
-	github.com/BurntSushi/toml v0.3.1 // indirect
+	github.com/BurntSushi/toml v0.3.1
 	github.com/atotto/clipboard v0.1.2
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/monochromegane/conflag v0.0.0-20151130130520-6d68c9aa4183
@@ -0,0 +1,212 @@
+package lemon
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Shared secret authentication is performed on every new connection before RPC codec is started.
+// Secret itself never goes over the wire and both sides prove knowledge of it answering fresh random challenges,
+// so captured session could not be replayed:
+//
+//	server -> client: magic, version, server nonce
+//	client -> server: HMAC(secret, "client" + server nonce), client nonce
+//	server -> client: status, HMAC(secret, "server" + client nonce)
+
+// SecretEnv is environment variable used when secret is not specified otherwise.
+const SecretEnv = "LEMONADE_SECRET"
+
+// ErrAuth is returned when authentication handshake fails.
+var ErrAuth = errors.New("authentication failed")
+
+const (
+	authMagic   = "LMND"
+	authVersion = 1
+	authTimeout = 10 * time.Second // how long HTTP challenge is valid
+	nonceSize   = 32
+
+	authOK     byte = 0
+	authFailed byte = 1
+
+	maxChallenges = 1024
+)
+
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+func authMAC(secret, role string, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(role))
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
+
+// handshakeDeadline limits time handshake on connection could take, 0 - unlimited. Returned function lifts the limit.
+func handshakeDeadline(conn net.Conn, timeout time.Duration) func() {
+	if timeout <= 0 {
+		return func() {}
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	return func() { _ = conn.SetDeadline(time.Time{}) }
+}
+
+// ServerHandshake authenticates client on newly accepted connection.
+func ServerHandshake(conn net.Conn, secret string, timeout time.Duration) error {
+
+	defer handshakeDeadline(conn, timeout)()
+
+	sNonce, err := newNonce()
+	if err != nil {
+		return fmt.Errorf("unable to generate nonce: %w", err)
+	}
+
+	hello := make([]byte, 0, len(authMagic)+1+nonceSize)
+	hello = append(hello, authMagic...)
+	hello = append(hello, authVersion)
+	hello = append(hello, sNonce...)
+	if _, err := conn.Write(hello); err != nil {
+		return fmt.Errorf("%w: unable to send challenge: %v", ErrAuth, err)
+	}
+
+	resp := make([]byte, sha256.Size+nonceSize)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return fmt.Errorf("%w: unable to read response: %v", ErrAuth, err)
+	}
+	cMAC, cNonce := resp[:sha256.Size], resp[sha256.Size:]
+
+	if !hmac.Equal(cMAC, authMAC(secret, "client", sNonce)) {
+		_, _ = conn.Write([]byte{authFailed})
+		return fmt.Errorf("%w: client response does not match", ErrAuth)
+	}
+
+	reply := make([]byte, 0, 1+sha256.Size)
+	reply = append(reply, authOK)
+	reply = append(reply, authMAC(secret, "server", cNonce)...)
+	if _, err := conn.Write(reply); err != nil {
+		return fmt.Errorf("%w: unable to send confirmation: %v", ErrAuth, err)
+	}
+	return nil
+}
+
+// ClientHandshake answers server challenge and authenticates server on newly established connection.
+func ClientHandshake(conn net.Conn, secret string, timeout time.Duration) error {
+
+	defer handshakeDeadline(conn, timeout)()
+
+	hello := make([]byte, len(authMagic)+1+nonceSize)
+	if _, err := io.ReadFull(conn, hello); err != nil {
+		return fmt.Errorf("%w: unable to read challenge (is server using secret?): %v", ErrAuth, err)
+	}
+	if !bytes.Equal(hello[:len(authMagic)], []byte(authMagic)) {
+		return fmt.Errorf("%w: unexpected challenge", ErrAuth)
+	}
+	if v := hello[len(authMagic)]; v != authVersion {
+		return fmt.Errorf("%w: unsupported handshake version %d", ErrAuth, v)
+	}
+	sNonce := hello[len(authMagic)+1:]
+
+	cNonce, err := newNonce()
+	if err != nil {
+		return fmt.Errorf("unable to generate nonce: %w", err)
+	}
+
+	resp := make([]byte, 0, sha256.Size+nonceSize)
+	resp = append(resp, authMAC(secret, "client", sNonce)...)
+	resp = append(resp, cNonce...)
+	if _, err := conn.Write(resp); err != nil {
+		return fmt.Errorf("%w: unable to send response: %v", ErrAuth, err)
+	}
+
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(conn, status); err != nil {
+		return fmt.Errorf("%w: unable to read confirmation: %v", ErrAuth, err)
+	}
+	if status[0] != authOK {
+		return fmt.Errorf("%w: rejected by server", ErrAuth)
+	}
+
+	sMAC := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(conn, sMAC); err != nil {
+		return fmt.Errorf("%w: unable to read confirmation: %v", ErrAuth, err)
+	}
+	if !hmac.Equal(sMAC, authMAC(secret, "server", cNonce)) {
+		return fmt.Errorf("%w: server response does not match", ErrAuth)
+	}
+	return nil
+}
+
+// Challenges keeps track of nonces issued to stateless (HTTP) clients. Client answers with the same
+// HMAC(secret, "client" + nonce) it would use during connection handshake, every nonce could be answered only once.
+type Challenges struct {
+	mu     sync.Mutex
+	issued map[string]time.Time
+}
+
+// NewChallenges initializes Challenges structure.
+func NewChallenges() *Challenges {
+	return &Challenges{
+		issued: make(map[string]time.Time),
+	}
+}
+
+// Issue generates new hex encoded challenge nonce.
+func (ch *Challenges) Issue() (string, error) {
+
+	nonce, err := newNonce()
+	if err != nil {
+		return "", fmt.Errorf("unable to generate nonce: %w", err)
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	now := time.Now()
+	for n, expires := range ch.issued {
+		if now.After(expires) {
+			delete(ch.issued, n)
+		}
+	}
+	if len(ch.issued) >= maxChallenges {
+		return "", errors.New("too many outstanding challenges")
+	}
+
+	n := hex.EncodeToString(nonce)
+	ch.issued[n] = now.Add(authTimeout)
+	return n, nil
+}
+
+// Verify checks hex encoded response to previously issued challenge.
+func (ch *Challenges) Verify(secret, nonce, response string) error {
+
+	ch.mu.Lock()
+	expires, ok := ch.issued[nonce]
+	delete(ch.issued, nonce)
+	ch.mu.Unlock()
+
+	if !ok || time.Now().After(expires) {
+		return fmt.Errorf("%w: unknown or expired challenge", ErrAuth)
+	}
+	n, err := hex.DecodeString(nonce)
+	if err != nil {
+		return fmt.Errorf("%w: bad challenge", ErrAuth)
+	}
+	mac, err := hex.DecodeString(response)
+	if err != nil || !hmac.Equal(mac, authMAC(secret, "client", n)) {
+		return fmt.Errorf("%w: response does not match", ErrAuth)
+	}
+	return nil
+}
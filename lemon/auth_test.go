@@ -0,0 +1,77 @@
+package lemon
+
+import (
+	"encoding/hex"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHandshake(t *testing.T) {
+	assert := func(serverSecret, clientSecret string, timeout time.Duration, success bool) {
+		sc, cc := net.Pipe()
+		defer sc.Close()
+		defer cc.Close()
+
+		done := make(chan error, 1)
+		go func() {
+			err := ServerHandshake(sc, serverSecret, timeout)
+			if err != nil {
+				// let client see the end of conversation
+				sc.Close()
+			}
+			done <- err
+		}()
+		cerr := ClientHandshake(cc, clientSecret, timeout)
+		serr := <-done
+
+		if success {
+			if cerr != nil || serr != nil {
+				t.Errorf("Expected success for '%s'/'%s', but got client: '%v', server: '%v'", serverSecret, clientSecret, cerr, serr)
+			}
+			return
+		}
+		if !errors.Is(cerr, ErrAuth) || !errors.Is(serr, ErrAuth) {
+			t.Errorf("Expected failure for '%s'/'%s', but got client: '%v', server: '%v'", serverSecret, clientSecret, cerr, serr)
+		}
+	}
+
+	assert("secret", "secret", time.Second, true)
+	assert("secret", "wrong", time.Second, false)
+	assert("", "secret", time.Second, false)
+	// no timeout means waiting forever rather than failing at once
+	assert("secret", "secret", 0, true)
+}
+
+func TestChallenges(t *testing.T) {
+
+	ch := NewChallenges()
+
+	n, err := ch.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nb, _ := hex.DecodeString(n)
+	resp := hex.EncodeToString(authMAC("secret", "client", nb))
+
+	if err := ch.Verify("secret", n, hex.EncodeToString(authMAC("wrong", "client", nb))); !errors.Is(err, ErrAuth) {
+		t.Errorf("Expected authentication failure for wrong secret, but got '%v'", err)
+	}
+	// every challenge could be answered only once
+	if err := ch.Verify("secret", n, resp); !errors.Is(err, ErrAuth) {
+		t.Errorf("Expected authentication failure for used challenge, but got '%v'", err)
+	}
+
+	if n, err = ch.Issue(); err != nil {
+		t.Fatal(err)
+	}
+	nb, _ = hex.DecodeString(n)
+	resp = hex.EncodeToString(authMAC("secret", "client", nb))
+	if err := ch.Verify("secret", n, resp); err != nil {
+		t.Errorf("Expected success, but got '%v'", err)
+	}
+	if err := ch.Verify("secret", n, resp); !errors.Is(err, ErrAuth) {
+		t.Errorf("Expected authentication failure for replayed response, but got '%v'", err)
+	}
+}
@@ -0,0 +1,241 @@
+package lemon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/atotto/clipboard"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+// Clipboard backends
+const (
+	BackendAtotto  = "atotto"
+	BackendCommand = "command"
+	BackendFile    = "file"
+	BackendMemory  = "memory"
+)
+
+// ClipboardBackend is where server keeps clipboard text.
+type ClipboardBackend interface {
+	ReadAll() (string, error)
+	WriteAll(text string) error
+}
+
+// TypedBackend is implemented by backends able to keep content of other MIME types.
+type TypedBackend interface {
+	ReadTyped(mime string) ([]byte, error)
+	WriteTyped(f param.ClipboardFormat) error
+}
+
+// MultiTypedBackend is implemented by backends able to keep several representations of the same content at once.
+type MultiTypedBackend interface {
+	WriteFormats(sel string, fs []param.ClipboardFormat) error
+}
+
+// SelectionBackend is implemented by backends having PRIMARY selection, empty MIME type means text.
+type SelectionBackend interface {
+	ReadPrimary(mime string) ([]byte, error)
+	WritePrimary(f param.ClipboardFormat) error
+}
+
+// NewBackend creates clipboard backend selected by configuration.
+func NewBackend(c *CLI) (ClipboardBackend, error) {
+	if c.Relay {
+		return newRelayBackend(c.RelayStore)
+	}
+	switch strings.ToLower(c.Backend) {
+	case "", BackendAtotto:
+		return newSystemBackend(), nil
+	case BackendCommand:
+		if len(c.CopyCmd) == 0 || len(c.PasteCmd) == 0 {
+			return nil, fmt.Errorf("both copy and paste commands are required by '%s' backend", BackendCommand)
+		}
+		return &commandBackend{copyCmd: c.CopyCmd, pasteCmd: c.PasteCmd}, nil
+	case BackendFile:
+		if len(c.BackendFile) == 0 {
+			return nil, fmt.Errorf("file name is required by '%s' backend", BackendFile)
+		}
+		return &fileBackend{path: c.BackendFile}, nil
+	case BackendMemory:
+		return newMemoryBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown clipboard backend '%s', should be one of %s, %s, %s or %s", c.Backend,
+			BackendAtotto, BackendCommand, BackendFile, BackendMemory)
+	}
+}
+
+// systemBackend uses system clipboard text via atotto/clipboard, platforms having tools for typed content extend it.
+type systemBackend struct{}
+
+func (systemBackend) ReadAll() (string, error) {
+	return clipboard.ReadAll()
+}
+
+func (systemBackend) WriteAll(text string) error {
+	return clipboard.WriteAll(text)
+}
+
+// commandBackend pipes clipboard text through user defined shell commands.
+type commandBackend struct {
+	copyCmd  string
+	pasteCmd string
+}
+
+// shell prepares to run command line with arguments appended.
+func shell(cmd string, args ...string) (string, []string) {
+	if runtime.GOOS == "windows" {
+		return "cmd", append([]string{"/C", cmd}, args...)
+	}
+	if len(args) > 0 {
+		cmd += ` "$@"`
+	}
+	return "sh", append([]string{"-c", cmd, "sh"}, args...)
+}
+
+// ShellCommand prepares command line to be run by shell with arguments appended.
+func ShellCommand(cmd string, args ...string) *exec.Cmd {
+	name, a := shell(cmd, args...)
+	return exec.Command(name, a...)
+}
+
+func (b *commandBackend) ReadAll() (string, error) {
+	name, args := shell(b.pasteCmd)
+	out, err := runTool(name, args...)
+	return string(out), err
+}
+
+func (b *commandBackend) WriteAll(text string) error {
+	name, args := shell(b.copyCmd)
+	return feedTool([]byte(text), name, args...)
+}
+
+// fileBackend keeps clipboard text in file, which is replaced atomically.
+type fileBackend struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (b *fileBackend) ReadAll() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data, err := ioutil.ReadFile(b.path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(data), err
+}
+
+func (b *fileBackend) WriteAll(text string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return writeFileAtomic(b.path, []byte(text))
+}
+
+// writeFileAtomic replaces file content, so readers never see partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// memoryBackend keeps everything in memory, it has PRIMARY selection and supports any content type.
+type memoryBackend struct {
+	mu  sync.Mutex
+	sel map[string]map[string][]byte // selection -> MIME type ("" for text) -> content
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{sel: make(map[string]map[string][]byte)}
+}
+
+func (b *memoryBackend) read(sel, mime string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if data, ok := b.sel[sel][mime]; ok {
+		return data, nil
+	}
+	if len(mime) == 0 {
+		return nil, nil
+	}
+	return nil, ErrTypeUnavailable
+}
+
+// write replaces selection content with all formats, the first one of the same type is kept.
+func (b *memoryBackend) write(sel string, fs ...param.ClipboardFormat) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	content := make(map[string][]byte, len(fs))
+	for _, f := range fs {
+		mime := f.MIME
+		if IsText(mime) {
+			mime = ""
+		}
+		if _, ok := content[mime]; !ok {
+			content[mime] = f.Data
+		}
+	}
+	b.sel[sel] = content
+	return nil
+}
+
+func (b *memoryBackend) ReadAll() (string, error) {
+	data, err := b.read(param.SelectionClipboard, "")
+	return string(data), err
+}
+
+func (b *memoryBackend) WriteAll(text string) error {
+	return b.write(param.SelectionClipboard, param.ClipboardFormat{Data: []byte(text)})
+}
+
+func (b *memoryBackend) ReadTyped(mime string) ([]byte, error) {
+	return b.read(param.SelectionClipboard, mime)
+}
+
+func (b *memoryBackend) WriteTyped(f param.ClipboardFormat) error {
+	return b.write(param.SelectionClipboard, f)
+}
+
+// WriteFormats sets selection ("both" sets both of them) to all formats at once.
+func (b *memoryBackend) WriteFormats(sel string, fs []param.ClipboardFormat) error {
+	sel = strings.ToLower(sel)
+	if sel != param.SelectionPrimary {
+		if err := b.write(param.SelectionClipboard, fs...); err != nil || sel != param.SelectionBoth {
+			return err
+		}
+	}
+	return b.write(param.SelectionPrimary, fs...)
+}
+
+func (b *memoryBackend) ReadPrimary(mime string) ([]byte, error) {
+	return b.read(param.SelectionPrimary, mime)
+}
+
+func (b *memoryBackend) WritePrimary(f param.ClipboardFormat) error {
+	return b.write(param.SelectionPrimary, f)
+}
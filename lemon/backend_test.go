@@ -0,0 +1,109 @@
+package lemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNewBackend(t *testing.T) {
+	assert := func(backend, expected string) {
+		t.Helper()
+		c := New()
+		c.Backend = backend
+		_, err := NewBackend(c)
+		if len(expected) == 0 {
+			if err != nil {
+				t.Errorf("Unexpected error for '%s': %v", backend, err)
+			}
+			return
+		}
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error for '%s' to contain '%s', but got '%v'", backend, expected, err)
+		}
+	}
+
+	assert("atotto", "")
+	assert("Memory", "")
+	assert("command", "commands are required")
+	assert("file", "file name is required")
+	assert("clipboard", "unknown clipboard backend")
+
+	// typed content is only advertised where platform has tools for it
+	_, typed := newSystemBackend().(TypedBackend)
+	switch runtime.GOOS {
+	case "windows":
+		if typed {
+			t.Errorf("Expected system backend to keep text only on %s", runtime.GOOS)
+		}
+	case "darwin", "linux":
+		if !typed {
+			t.Errorf("Expected system backend to keep typed content on %s", runtime.GOOS)
+		}
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "lemonade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := &fileBackend{path: filepath.Join(dir, "clipboard")}
+	if text, err := b.ReadAll(); err != nil || text != "" {
+		t.Errorf("Expected empty clipboard, but got '%s' '%v'", text, err)
+	}
+	for _, text := range []string{"first", "second\nline"} {
+		if err := b.WriteAll(text); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := b.ReadAll(); err != nil || got != text {
+			t.Errorf("Expected '%s', but got '%s' '%v'", text, got, err)
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expected no temporary files left, but got %d files", len(files))
+	}
+}
+
+func TestCommandBackend(t *testing.T) {
+
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "lemonade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "clipboard")
+	c := New()
+	c.Backend = BackendCommand
+	c.CopyCmd = "cat > '" + path + "'"
+	c.PasteCmd = "cat '" + path + "'"
+	b, err := NewBackend(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.WriteAll("text"); err != nil {
+		t.Fatal(err)
+	}
+	if text, err := b.ReadAll(); err != nil || text != "text" {
+		t.Errorf("Expected 'text', but got '%s' '%v'", text, err)
+	}
+
+	c.PasteCmd = "echo failure >&2; exit 3"
+	if b, err = NewBackend(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.ReadAll(); err == nil || !strings.Contains(err.Error(), "failure") {
+		t.Errorf("Expected command error, but got '%v'", err)
+	}
+}
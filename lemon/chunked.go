@@ -0,0 +1,206 @@
+package lemon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+// MaxChunk is the largest chunk of chunked transfer in either direction.
+const MaxChunk = 1 << 20
+
+// MaxUpload limits size of chunked upload when server has no copy size limit configured, uploaded content is kept
+// in memory.
+const MaxUpload = 256 << 20
+
+// Upload is discarded when no chunk arrives for that long. Replaceable for testing.
+var uploadExpiry = time.Minute
+
+// Limit enforced instead of MaxUpload. Replaceable for testing.
+var uploadCap = MaxUpload
+
+// Errors reported by chunked transfers.
+var (
+	ErrChecksum   = errors.New("checksum mismatch")
+	ErrNoTransfer = errors.New("no transfer in progress")
+)
+
+type upload struct {
+	p     param.TransferParam
+	buf   bytes.Buffer
+	timer *time.Timer
+}
+
+type download struct {
+	data []byte
+	off  int
+}
+
+// HashBytes returns hash used to verify chunked transfers.
+func HashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// CopyBegin is implementation of "lemonade" rpc starting chunked "copy" command. Previous unfinished upload on the
+// same connection is discarded.
+func (c *Clipboard) CopyBegin(p *param.TransferParam, _ *struct{}) error {
+	if err := c.svc.checkRate(c.peer); err != nil {
+		return err
+	}
+	if err := checkSize("copied content", p.Size, c.uploadLimit()); err != nil {
+		log.Printf("lemonade CopyBegin request from '%s' rejected: %s", c.peer, err.Error())
+		return err
+	}
+	if err := c.svc.checkSelection(p.Selection); err != nil {
+		return err
+	}
+	if c.cli.Debug {
+		log.Printf("lemonade CopyBegin request from '%s' for '%s', size %d, selection '%s'", c.peer, p.MIME, p.Size, p.Selection)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dropUpload()
+	u := &upload{p: *p}
+	u.timer = time.AfterFunc(uploadExpiry, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.upload == u {
+			log.Printf("lemonade upload from '%s' expired after %d bytes received", c.peer, u.buf.Len())
+			c.upload = nil
+		}
+	})
+	c.upload = u
+	return nil
+}
+
+// uploadLimit returns maximum size of chunked upload or decompressed content, it is never unlimited.
+func (c *Clipboard) uploadLimit() int {
+	if c.cli.MaxCopySize > 0 {
+		return c.cli.MaxCopySize
+	}
+	return uploadCap
+}
+
+// dropUpload discards unfinished upload, it has to be called with lock held.
+func (c *Clipboard) dropUpload() {
+	if c.upload != nil {
+		c.upload.timer.Stop()
+		c.upload = nil
+	}
+}
+
+// release discards transfers in progress when connection is closed.
+func (c *Clipboard) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.upload != nil && c.cli.Debug {
+		log.Printf("lemonade upload from '%s' discarded after %d bytes received, connection is closed", c.peer, c.upload.buf.Len())
+	}
+	c.dropUpload()
+	c.download = nil
+}
+
+// CopyChunk is implementation of "lemonade" rpc receiving next part of chunked "copy" command.
+func (c *Clipboard) CopyChunk(data []byte, _ *struct{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	u := c.upload
+	if u == nil {
+		return ErrNoTransfer
+	}
+	if err := checkSize("copied content", u.buf.Len()+len(data), c.uploadLimit()); err != nil {
+		log.Printf("lemonade CopyChunk request from '%s' rejected: %s", c.peer, err.Error())
+		c.dropUpload()
+		return err
+	}
+	u.buf.Write(data)
+	u.timer.Reset(uploadExpiry)
+	return nil
+}
+
+// CopyEnd is implementation of "lemonade" rpc finishing chunked "copy" command, clipboard is only changed if
+// received content matches checksum.
+func (c *Clipboard) CopyEnd(sum string, _ *struct{}) error {
+	c.mu.Lock()
+	u := c.upload
+	c.dropUpload()
+	c.mu.Unlock()
+
+	if u == nil {
+		return ErrNoTransfer
+	}
+	data, err := Decompress(u.buf.Bytes(), u.p.Compression, c.uploadLimit(), c.cli.Debug)
+	if err != nil {
+		log.Printf("lemonade CopyEnd request from '%s' rejected: %s", c.peer, err.Error())
+		return err
+	}
+	if got := HashBytes(data); got != sum {
+		log.Printf("lemonade CopyEnd request from '%s' rejected: %d bytes received, checksum does not match", c.peer, u.buf.Len())
+		return fmt.Errorf("%w: %d bytes received", ErrChecksum, u.buf.Len())
+	}
+	if c.cli.Debug {
+		log.Printf("lemonade CopyEnd request from '%s' received %d bytes", c.peer, u.buf.Len())
+	}
+	return c.copyFormats("CopyEnd", u.p.Selection, author{origin: u.p.Origin, host: u.p.Host, user: u.p.User}, []param.ClipboardFormat{{MIME: u.p.MIME, Data: data}})
+}
+
+// PasteBegin is implementation of "lemonade" rpc starting chunked "paste" command.
+func (c *Clipboard) PasteBegin(p *param.PasteTypedParam, resp *param.TransferInfo) error {
+	if err := c.svc.checkRate(c.peer); err != nil {
+		return err
+	}
+	if err := c.svc.checkSelection(p.Selection); err != nil {
+		return err
+	}
+	f, err := c.pasteFormat("PasteBegin", p.Selection, p.Types)
+	if err != nil {
+		return err
+	}
+	if c.cli.Debug {
+		log.Printf("lemonade PasteBegin request from '%s' for %v, selection '%s': '%s' %d bytes", c.peer, p.Types, p.Selection, f.MIME, len(f.Data))
+	}
+
+	sum := HashBytes(f.Data)
+	if f.Data, f.Compression, err = Compress(f.Data, p.Compression, c.cli.CompressThreshold, c.cli.Debug); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.download = &download{data: f.Data}
+	*resp = param.TransferInfo{MIME: f.MIME, Size: len(f.Data), Hash: sum, Compression: f.Compression}
+	return nil
+}
+
+// PasteChunk is implementation of "lemonade" rpc sending next part of chunked "paste" command, empty chunk is sent
+// when all content is transferred.
+func (c *Clipboard) PasteChunk(size int, resp *[]byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	d := c.download
+	if d == nil {
+		return ErrNoTransfer
+	}
+	if size <= 0 || size > MaxChunk {
+		size = MaxChunk
+	}
+	if rest := len(d.data) - d.off; size > rest {
+		size = rest
+	}
+	*resp = d.data[d.off : d.off+size]
+	d.off += size
+	if size == 0 {
+		c.download = nil
+	}
+	return nil
+}
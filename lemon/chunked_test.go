@@ -0,0 +1,223 @@
+package lemon
+
+import (
+	"bytes"
+	"net"
+	"net/rpc"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+func TestChunkedTransfer(t *testing.T) {
+
+	m := newMemClipboard()
+	svc := NewService(New(), m)
+
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	data := bytes.Repeat([]byte("0123456789"), MaxChunk/5)
+	if err := rc.Call("Clipboard.CopyBegin", &param.TransferParam{MIME: param.MIMEText, Size: len(data)}, dummy); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(data); i += 1000 {
+		end := i + 1000
+		if end > len(data) {
+			end = len(data)
+		}
+		if err := rc.Call("Clipboard.CopyChunk", data[i:end], dummy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// nothing is changed until transfer is finished
+	if text, _ := m.ReadAll(); len(text) != 0 {
+		t.Errorf("Expected clipboard to stay empty before transfer is finished, but got %d bytes", len(text))
+	}
+	if err := rc.Call("Clipboard.CopyEnd", HashBytes(data), dummy); err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := m.ReadAll(); text != string(data) {
+		t.Errorf("Expected %d bytes in clipboard, but got %d", len(data), len(text))
+	}
+
+	var info param.TransferInfo
+	if err := rc.Call("Clipboard.PasteBegin", &param.PasteTypedParam{Types: []string{param.MIMEText}}, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != len(data) || info.Hash != HashBytes(data) || info.MIME != param.MIMEText {
+		t.Errorf("Unexpected transfer info %+v", info)
+	}
+	var got []byte
+	for {
+		var chunk []byte
+		if err := rc.Call("Clipboard.PasteChunk", 0, &chunk); err != nil {
+			t.Fatal(err)
+		}
+		if len(chunk) == 0 {
+			break
+		}
+		if len(chunk) > MaxChunk {
+			t.Errorf("Expected chunk no larger than %d bytes, but got %d", MaxChunk, len(chunk))
+		}
+		got = append(got, chunk...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Expected %d bytes pasted, but got %d", len(data), len(got))
+	}
+	if err := rc.Call("Clipboard.PasteChunk", 0, new([]byte)); err == nil || !strings.Contains(err.Error(), ErrNoTransfer.Error()) {
+		t.Errorf("Expected no transfer error after download is finished, but got '%v'", err)
+	}
+}
+
+func TestChunkedTransferErrors(t *testing.T) {
+
+	m := newMemClipboard()
+	c := New()
+	c.MaxCopySize = 8
+	svc := NewService(c, m)
+
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	assert := func(err, expected error) {
+		t.Helper()
+		if err == nil || !strings.Contains(err.Error(), expected.Error()) {
+			t.Errorf("Expected '%v', but got '%v'", expected, err)
+		}
+	}
+
+	assert(rc.Call("Clipboard.CopyChunk", []byte("text"), dummy), ErrNoTransfer)
+	assert(rc.Call("Clipboard.CopyEnd", HashBytes(nil), dummy), ErrNoTransfer)
+
+	// known size is checked up front, unknown as content arrives
+	assert(rc.Call("Clipboard.CopyBegin", &param.TransferParam{Size: 9}, dummy), ErrTooLarge)
+	if err := rc.Call("Clipboard.CopyBegin", &param.TransferParam{Size: -1}, dummy); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Call("Clipboard.CopyChunk", []byte("12345"), dummy); err != nil {
+		t.Fatal(err)
+	}
+	assert(rc.Call("Clipboard.CopyChunk", []byte("6789"), dummy), ErrTooLarge)
+	// and rejected transfer is dropped
+	assert(rc.Call("Clipboard.CopyEnd", HashBytes([]byte("12345")), dummy), ErrNoTransfer)
+
+	if err := rc.Call("Clipboard.CopyBegin", &param.TransferParam{Size: -1}, dummy); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Call("Clipboard.CopyChunk", []byte("text"), dummy); err != nil {
+		t.Fatal(err)
+	}
+	assert(rc.Call("Clipboard.CopyEnd", HashBytes([]byte("test")), dummy), ErrChecksum)
+	if text, _ := m.ReadAll(); len(text) != 0 {
+		t.Errorf("Expected clipboard to stay empty on checksum mismatch, but got '%s'", text)
+	}
+
+	assert(rc.Call("Clipboard.PasteChunk", 0, new([]byte)), ErrNoTransfer)
+}
+
+func TestChunkedTransferAbort(t *testing.T) {
+
+	m := newMemClipboard()
+	svc := NewService(New(), m)
+
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	if err := rc.Call("Clipboard.CopyBegin", &param.TransferParam{Size: -1}, dummy); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Call("Clipboard.CopyChunk", []byte("partial"), dummy); err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+
+	// transfers belong to connection, new one does not see it
+	rc = dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+	if err := rc.Call("Clipboard.CopyEnd", HashBytes([]byte("partial")), dummy); err == nil || !strings.Contains(err.Error(), ErrNoTransfer.Error()) {
+		t.Errorf("Expected no transfer error finishing transfer started on another connection, but got '%v'", err)
+	}
+	if text, _ := m.ReadAll(); len(text) != 0 {
+		t.Errorf("Expected clipboard to stay empty after aborted transfer, but got '%s'", text)
+	}
+}
+
+func TestChunkedTransferRelease(t *testing.T) {
+
+	m := newMemClipboard()
+	svc := NewService(New(), m)
+
+	clips := make(chan *Clipboard, 1)
+	defer func(f func(*Service, net.Addr) *Clipboard) { connClipboard = f }(connClipboard)
+	connClipboard = func(s *Service, peer net.Addr) *Clipboard {
+		c := NewClipboard(s, peer)
+		clips <- c
+		return c
+	}
+
+	sc, cc := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		_ = svc.ServeConn(&peerConn{Conn: sc, peer: &net.TCPAddr{IP: net.ParseIP("192.168.0.1")}}, CodecGob)
+		close(done)
+	}()
+	rc := rpc.NewClient(cc)
+	if err := rc.Call("Clipboard.CopyBegin", &param.TransferParam{Size: -1}, dummy); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Call("Clipboard.CopyChunk", []byte("partial"), dummy); err != nil {
+		t.Fatal(err)
+	}
+	var info param.TransferInfo
+	if err := rc.Call("Clipboard.PasteBegin", &param.PasteTypedParam{Types: []string{param.MIMEText}}, &info); err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected connection to be served until it is closed")
+	}
+	// transfers are released with connection, not when upload expires
+	c := <-clips
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.upload != nil || c.download != nil {
+		t.Errorf("Expected transfers to be released when connection is closed")
+	}
+}
+
+func TestChunkedTransferLimits(t *testing.T) {
+
+	m := newMemClipboard()
+	svc := NewService(New(), m)
+
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	// uploads are limited even when copy size is not
+	if err := rc.Call("Clipboard.CopyBegin", &param.TransferParam{Size: MaxUpload + 1}, dummy); err == nil || !strings.Contains(err.Error(), ErrTooLarge.Error()) {
+		t.Errorf("Expected upload above hard limit to be rejected, but got '%v'", err)
+	}
+
+	// abandoned upload is dropped, active one is kept
+	saved := uploadExpiry
+	uploadExpiry = 50 * time.Millisecond
+	defer func() { uploadExpiry = saved }()
+
+	if err := rc.Call("Clipboard.CopyBegin", &param.TransferParam{Size: -1}, dummy); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		time.Sleep(20 * time.Millisecond)
+		if err := rc.Call("Clipboard.CopyChunk", []byte("x"), dummy); err != nil {
+			t.Fatalf("Expected active upload to be kept, but got '%v'", err)
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := rc.Call("Clipboard.CopyChunk", []byte("x"), dummy); err == nil || !strings.Contains(err.Error(), ErrNoTransfer.Error()) {
+		t.Errorf("Expected abandoned upload to be dropped, but got '%v'", err)
+	}
+}
@@ -1,22 +1,34 @@
 package lemon
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"net/rpc"
 	"os"
-	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rupor-github/lemonade/misc"
+	"github.com/rupor-github/lemonade/param"
 )
 
 // LastGitCommit hold git hash from build.
 var LastGitCommit string
 
+const unixScheme = "unix://"
+
+// Sync directions
+const (
+	SyncPush = "push"
+	SyncPull = "pull"
+	SyncBoth = "both"
+)
+
 // Command enum defines what we are executing.
 type Command int
 
@@ -26,44 +38,176 @@ const (
 	CmdCopy
 	CmdPaste
 	CmdServer
+	CmdVersion
+	CmdHistory
+	CmdSync
+	CmdStat
 )
 
 // CLI holds program state.
 type CLI struct {
 	Cmd        Command
 	DataSource string
+	// copied content is streamed from here when not given on command line
+	DataReader io.Reader
 
 	// option flags
-	Port             int
-	Allow            string
-	Host             string
-	TransLoopback    bool
-	TransLocalfile   bool
-	TransFileTimeout time.Duration
-	TransFilePort    int
-	LineEnding       string
-	Help             bool
-	Debug            bool
+	Port              int
+	Allow             string
+	AllowRefresh      time.Duration
+	Host              string
+	SocketPerm        string
+	TransLoopback     bool
+	TransLocalfile    bool
+	TransFileTimeout  time.Duration
+	TransFilePort     int
+	LineEnding        string
+	Transforms        Transforms
+	CopyTransforms    Transforms
+	PasteTransforms   Transforms
+	Encoding          string
+	EncodingErrors    string
+	Type              string
+	Selection         string
+	Backend           string
+	CopyCmd           string
+	PasteCmd          string
+	BackendFile       string
+	Relay             bool
+	RelayStore        string
+	OpenCmd           string
+	Secret            string
+	TLS               bool
+	TLSCert           string
+	TLSKey            string
+	TLSCA             string
+	TLSServerName     string
+	TLSVerifyClient   bool
+	JSONRPC           bool
+	JSONRPCPort       int
+	HTTPPort          int
+	MaxCopySize       int
+	MaxURISize        int
+	RateLimit         float64
+	RateBurst         int
+	HandshakeTimeout  time.Duration
+	IdleTimeout       time.Duration
+	CallTimeout       time.Duration
+	KeepAlive         time.Duration
+	MaxConns          int
+	HistorySize       int
+	HistoryMaxBytes   int
+	HistoryExclude    RegexpList
+	Policy            string
+	PolicyBuiltin     bool
+	ClipboardPoll     time.Duration
+	OSC52             bool
+	OSC52Fallback     bool
+	OSC52MaxSize      int
+	Remote            bool
+	Watch             bool
+	WatchSeparator    string
+	WatchExec         string
+	WatchHash         bool
+	SyncDirection     string
+	SyncDebounce      time.Duration
+	Promote           bool
+	JSON              bool
+	ReportIdentity    bool
+	Progress          bool
+	Files             FileList
+	FileSeparator     string
+	Output            string
+	Append            bool
+	OutputPerm        string
+	Compress          string
+	CompressThreshold int
+	Help              bool
+	Debug             bool
 	// and our flagset
 	Flags *flag.FlagSet
 
-	// used by our server,
-	ConnCh chan net.Conn
+	// server information, requested lazily by client
+	info *param.InfoResult
 }
 
 // New initializes environment.
 func New() *CLI {
 
 	c := &CLI{
-		ConnCh: make(chan net.Conn, 1),
-		Flags:  flag.NewFlagSet("lemonade", flag.ContinueOnError),
+		Flags: flag.NewFlagSet("lemonade", flag.ContinueOnError),
 	}
 
 	c.Flags.BoolVar(&c.Help, "help", false, "Show this message")
 	c.Flags.IntVar(&c.Port, "port", 2489, "TCP port number")
-	c.Flags.StringVar(&c.Allow, "allow", "0.0.0.0/0,::/0", "Allow IP range [server only]")
-	c.Flags.StringVar(&c.Host, "host", "localhost", "Destination host name [client only]")
-	c.Flags.StringVar(&c.LineEnding, "line-ending", "", "Convert Line Endings (LF/CRLF)")
+	c.Flags.StringVar(&c.Allow, "allow", "0.0.0.0/0,::/0",
+		"Allow IP range - ordered list of IPs, CIDRs, host names or groups (any, loopback, private, link-local), '!' prefix denies [server only]")
+	c.Flags.DurationVar(&c.AllowRefresh, "allow-refresh", 5*time.Minute, "How often to resolve host names from allowed range again [server only]")
+	c.Flags.StringVar(&c.Host, "host", "localhost", "Destination host name [client only] or unix socket as unix:///path [both]")
+	c.Flags.StringVar(&c.SocketPerm, "socket-perm", "0600", "Permissions of unix socket [server only]")
+	c.Flags.StringVar(&c.LineEnding, "line-ending", "", "Convert Line Endings (LF/CRLF), applied after all other transforms by server to copied text and by client to pasted text")
+	c.Flags.StringVar(&c.Encoding, "encoding", "", "Character encoding of copied input and pasted output: utf-8, utf-16 (with BOM), utf-16le, utf-16be, windows-1252 or latin1, content is passed as is unless this or --encoding-errors is given, then UTF-16 input with BOM is always detected [copy and paste commands only]")
+	c.Flags.StringVar(&c.EncodingErrors, "encoding-errors", "", "What to do with text which could not be converted to or from encoding, including invalid UTF-8: replace (default when --encoding is given) or fail [copy and paste commands only]")
+	c.Flags.Var(&c.Transforms, "transform", "Comma separated transforms applied in order to copied and pasted text: "+strings.Join(TransformNames(), ", ")+
+		", some take argument after colon (expand-tabs:4), could be repeated, server applies its own to copied text after client")
+	c.Flags.Var(&c.CopyTransforms, "copy-transform", "Transforms applied to copied text only, after common ones [server and copy command]")
+	c.Flags.Var(&c.PasteTransforms, "paste-transform", "Transforms applied to pasted text only, after common ones [paste, history and sync commands]")
+	c.Flags.StringVar(&c.Type, "type", "", "MIME type of clipboard content, e.g. image/png [copy and paste commands only]")
+	c.Flags.StringVar(&c.Selection, "selection", "", "Selection to use: clipboard, primary or both (default clipboard) [copy and paste commands only]")
+	c.Flags.StringVar(&c.Secret, "secret", "", "Shared secret to authenticate connections (default $"+SecretEnv+")")
+	c.Flags.BoolVar(&c.TLS, "tls", false, "Use TLS transport")
+	c.Flags.StringVar(&c.TLSCert, "tls-cert", "", "TLS certificate file (client certificate is used for mutual authentication)")
+	c.Flags.StringVar(&c.TLSKey, "tls-key", "", "TLS private key file")
+	c.Flags.StringVar(&c.TLSCA, "tls-ca", "", "TLS CA certificate file to verify peer with (client trusts only this CA)")
+	c.Flags.StringVar(&c.TLSServerName, "tls-server-name", "", "Override server name used to verify server certificate [client only]")
+	c.Flags.BoolVar(&c.TLSVerifyClient, "tls-verify-client", false, "Require and verify client certificates [server only]")
+	c.Flags.BoolVar(&c.JSONRPC, "jsonrpc", false, "Also accept JSON-RPC requests, codec is detected automatically [server only]")
+	c.Flags.IntVar(&c.JSONRPCPort, "jsonrpc-port", 0, "Additional TCP port to serve JSON-RPC requests only on [server only]")
+	c.Flags.IntVar(&c.HTTPPort, "http-port", 0, "TCP port to serve HTTP API on [server only]")
+	c.Flags.IntVar(&c.MaxCopySize, "max-copy-size", 0, "Maximum size of copied content in bytes, 0 - unlimited, but content uploaded in chunks is still limited to 256MB [server only]")
+	c.Flags.IntVar(&c.MaxURISize, "max-uri-size", 0, "Maximum size of URI to open in bytes, 0 - unlimited [server only]")
+	c.Flags.Float64Var(&c.RateLimit, "rate-limit", 0, "Maximum calls per second from single remote IP, 0 - unlimited [server only]")
+	c.Flags.IntVar(&c.RateBurst, "rate-burst", 0, "Number of calls allowed above rate limit in a burst, 0 - same as rate limit [server only]")
+	c.Flags.DurationVar(&c.HandshakeTimeout, "handshake-timeout", 10*time.Second, "How long to wait for TLS and authentication handshakes to complete, 0 - forever")
+	c.Flags.DurationVar(&c.IdleTimeout, "idle-timeout", 0, "Close connections without requests for that long, 0 - never [server only]")
+	c.Flags.DurationVar(&c.CallTimeout, "call-timeout", 0, "Fail calls taking longer than that, 0 - never [server only]")
+	c.Flags.DurationVar(&c.KeepAlive, "tcp-keepalive", 0, "TCP keep-alive period, 0 - system default, negative - disabled [server only]")
+	c.Flags.IntVar(&c.MaxConns, "max-conns", 0, "Maximum number of concurrent connections, new ones wait until some are closed, 0 - unlimited [server only]")
+	c.Flags.StringVar(&c.Backend, "backend", BackendAtotto, "Where to keep clipboard content: atotto (system clipboard), command, file or memory [server and sync command]")
+	c.Flags.StringVar(&c.CopyCmd, "copy-cmd", "", "Shell command receiving copied text on stdin for command backend [server and sync command]")
+	c.Flags.StringVar(&c.PasteCmd, "paste-cmd", "", "Shell command printing clipboard text to stdout for command backend [server and sync command]")
+	c.Flags.StringVar(&c.BackendFile, "backend-file", "", "File to keep clipboard text in for file backend [server and sync command]")
+	c.Flags.BoolVar(&c.Relay, "relay", false, "Keep clipboard in memory to share it among clients without desktop, URIs are not opened unless open command is set [server only]")
+	c.Flags.StringVar(&c.RelayStore, "relay-store", "", "File to persist relay clipboard in [server only]")
+	c.Flags.StringVar(&c.OpenCmd, "open-cmd", "", "Command to open URIs with, URI is passed as the last argument, on Windows it is run directly rather than by cmd.exe [server only]")
+	c.Flags.IntVar(&c.HistorySize, "history-size", 0, "Number of recent clipboard entries to keep, 0 - history is disabled [server only]")
+	c.Flags.IntVar(&c.HistoryMaxBytes, "history-max-bytes", 0, "Maximum total size of kept entries in bytes, larger entries are never kept, 0 - unlimited [server only]")
+	c.Flags.Var(&c.HistoryExclude, "history-exclude", "Regular expression, matching text is never kept in history, could be repeated [server only]")
+	c.Flags.StringVar(&c.Policy, "policy", "", "Policy file with rules to reject, redact or mark as sensitive copied and pasted text, built-in secret detection rules are used unless file disables them [server only]")
+	c.Flags.BoolVar(&c.PolicyBuiltin, "policy-builtin", false, "Mark copied and pasted text matching built-in secret detection rules as sensitive without policy file, sensitive content is cleared from clipboard after 30s [server only]")
+	c.Flags.DurationVar(&c.ClipboardPoll, "clipboard-poll", 2*time.Second, "How often to check clipboard for local changes to keep in history, report to watching clients [server only] or push to server [sync command only], 0 - never")
+	c.Flags.DurationVar(&c.ClipboardPoll, "history-poll", 2*time.Second, "Deprecated alias of --clipboard-poll")
+	c.Flags.BoolVar(&c.Remote, "remote", false, "Query server version [version command only]")
+	c.Flags.BoolVar(&c.OSC52, "osc52", false, "Copy using OSC 52 terminal escape sequence without contacting server [copy command only]")
+	c.Flags.BoolVar(&c.OSC52Fallback, "osc52-fallback", false, "Copy using OSC 52 terminal escape sequence when server is unreachable [copy command only]")
+	c.Flags.IntVar(&c.OSC52MaxSize, "osc52-max-size", osc52MaxSize, "Maximum size of text to copy using OSC 52 in bytes, 0 - unlimited [copy command only]")
+	c.Flags.BoolVar(&c.Watch, "watch", false, "Keep running and output clipboard every time it changes [paste command only]")
+	c.Flags.StringVar(&c.WatchSeparator, "watch-separator", `\n`, "Separator to output after every clipboard change, Go escape sequences are allowed [paste command only]")
+	c.Flags.StringVar(&c.WatchExec, "watch-exec", "", "Shell command to run on every clipboard change with content on stdin instead of output [paste command only]")
+	c.Flags.BoolVar(&c.WatchHash, "watch-hash", false, "Output hash of clipboard content rather than content itself [paste command only]")
+	c.Flags.StringVar(&c.SyncDirection, "sync-direction", SyncBoth, "What to synchronize: push local changes to server, pull server changes or both [sync command only]")
+	c.Flags.DurationVar(&c.SyncDebounce, "sync-debounce", 500*time.Millisecond, "Wait for clipboard to stay unchanged that long before synchronizing it [sync command only]")
+	c.Flags.StringVar(&c.Compress, "compress", param.CompressionNone, "Compress content sent to and received from server: none, gzip or flate [copy and paste commands only]")
+	c.Flags.IntVar(&c.CompressThreshold, "compress-threshold", defaultCompressThreshold, "Content smaller than that is never compressed, in bytes [server, copy and paste commands]")
+	c.Flags.Var(&c.Files, "file", "File to copy instead of text argument or stdin, could be repeated [copy command only]")
+	c.Flags.StringVar(&c.FileSeparator, "file-separator", "", "Separator to put between copied files, Go escape sequences are allowed, files are concatenated by default [copy command only]")
+	c.Flags.StringVar(&c.Output, "output", "", "File to write pasted content to instead of stdout, it is replaced atomically [paste command only]")
+	c.Flags.BoolVar(&c.Append, "append", false, "Append pasted content to output file rather than replace it [paste command only]")
+	c.Flags.StringVar(&c.OutputPerm, "output-perm", "", "Permissions of output file, existing file keeps its permissions and new one gets 0644 by default [paste command only]")
+	c.Flags.BoolVar(&c.Progress, "progress", false, "Report transfer progress of large content on stderr [copy and paste commands only]")
+	c.Flags.BoolVar(&c.Promote, "promote", false, "Make history entry current clipboard content [history command only]")
+	c.Flags.BoolVar(&c.JSON, "json", false, "Output in JSON format [stat command only]")
+	c.Flags.BoolVar(&c.ReportIdentity, "report-identity", false, "Tell server host and user names along with copied content, so stat command could show who copied it [copy and sync commands only]")
 	c.Flags.BoolVar(&c.TransLoopback, "trans-loopback", true, "Replace loopback address [open command only]")
 	c.Flags.BoolVar(&c.TransLocalfile, "trans-localfile", true, "Transfer local file [open command only]")
 	c.Flags.IntVar(&c.TransFilePort, "trans-localfile-port", 2490, "Port to listen on transfer local file [open command only]")
@@ -90,6 +234,10 @@ Commands:
 	paste		 - output server clipboard locally
 	open 'url'	 - open url in server's default browser
 	server		 - start server
+	version		 - print version, use --remote to query server
+	history [N]	 - list server clipboard history or output entry N, use --promote to make it current
+	sync		 - keep local clipboard in sync with server
+	stat		 - describe server clipboard content: who set it, when, size, type and hash
 
 Options:
 
@@ -100,12 +248,45 @@ Options:
 	return c
 }
 
+// IsUnixSocket checks if unix domain socket is requested rather than TCP.
+func (c *CLI) IsUnixSocket() bool {
+	return strings.HasPrefix(c.Host, unixScheme)
+}
+
+// Endpoint returns network and address to dial.
+func (c *CLI) Endpoint() (string, string) {
+	if c.IsUnixSocket() {
+		return "unix", strings.TrimPrefix(c.Host, unixScheme)
+	}
+	return "tcp", net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
 // ProcessRPC makes RPC call.
 func (c *CLI) ProcessRPC(f func(*rpc.Client) error) error {
-	rc, err := rpc.Dial("tcp", fmt.Sprintf("%s:%d", c.Host, c.Port))
+	network, address := c.Endpoint()
+	conn, err := net.Dial(network, address)
 	if err != nil {
 		return err
 	}
+	if c.TLS {
+		cfg, err := c.ClientTLSConfig()
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		conn = tls.Client(conn, cfg)
+		if err := TLSHandshake(conn, c.HandshakeTimeout); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	if len(c.Secret) > 0 {
+		if err := ClientHandshake(conn, c.Secret, c.HandshakeTimeout); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	rc := rpc.NewClient(conn)
 	// Do not leak connections
 	defer rc.Close()
 
@@ -114,18 +295,3 @@ func (c *CLI) ProcessRPC(f func(*rpc.Client) error) error {
 	}
 	return nil
 }
-
-// ConvertLineEnding is used to normaliza line endings when exchanging clipboard content.
-func (c *CLI) ConvertLineEnding(text string) string {
-	switch {
-	case strings.EqualFold("lf", c.LineEnding):
-		text = strings.Replace(text, "\r\n", "\n", -1)
-		return strings.Replace(text, "\r", "\n", -1)
-	case strings.EqualFold("crlf", c.LineEnding):
-		text = regexp.MustCompile(`\r(.)|\r$`).ReplaceAllString(text, "\r\n$1")
-		text = regexp.MustCompile(`([^\r])\n|^\n`).ReplaceAllString(text, "$1\r\n")
-		return text
-	default:
-		return text
-	}
-}
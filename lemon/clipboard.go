@@ -2,39 +2,76 @@ package lemon
 
 import (
 	"log"
+	"net"
+	"sync"
 
-	"github.com/atotto/clipboard"
+	"github.com/rupor-github/lemonade/param"
 )
 
 // Clipboard is used by "lemonade" to rpc clipboard content.
 type Clipboard struct {
-	cli *CLI
+	cli  *CLI
+	svc  *Service
+	peer net.Addr
+
+	// chunked transfers in progress on this connection
+	mu       sync.Mutex
+	upload   *upload
+	download *download
 }
 
-// NewClipboard initializes Clipboard structure.
-func NewClipboard(c *CLI) *Clipboard {
+// NewClipboard initializes Clipboard structure for connection with peer.
+func NewClipboard(s *Service, peer net.Addr) *Clipboard {
 	return &Clipboard{
-		cli: c,
+		cli:  s.cli,
+		svc:  s,
+		peer: peer,
 	}
 }
 
 // Copy is implementation of "lemonade" rpc "copy" command.
 func (c *Clipboard) Copy(text string, _ *struct{}) error {
-	<-c.cli.ConnCh
+	if err := c.svc.checkRate(c.peer); err != nil {
+		return err
+	}
+	if err := checkSize("copied text", len(text), c.cli.MaxCopySize); err != nil {
+		log.Printf("lemonade Copy request from '%s' rejected: %s", c.peer, err.Error())
+		return err
+	}
 	if c.cli.Debug {
-		log.Printf("lemonade Copy request received len: %d", len(text))
+		log.Printf("lemonade Copy request from '%s' received len: %d", c.peer, len(text))
 	}
 	// Logger instance needs to be passed here somehow?
-	return clipboard.WriteAll(c.cli.ConvertLineEnding(text))
+	text = c.cli.Transform(DirCopy, text)
+	text, sensitive, err := c.svc.applyPolicy("Copy", c.peer, text)
+	if err != nil {
+		return err
+	}
+	_, err = c.svc.call("Copy", c.peer, func() (string, error) {
+		return "", c.svc.backend.WriteAll(text)
+	})
+	if err == nil {
+		c.svc.changed(text, peerSource(c.peer), "")
+		c.recordCopy(param.MIMEText, []byte(text), author{})
+		if sensitive {
+			c.svc.clearSensitive("", text)
+		}
+	}
+	return err
 }
 
 // Paste is implementation of "lemonade" rpc "paste" command.
 func (c *Clipboard) Paste(_ struct{}, resp *string) error {
-	<-c.cli.ConnCh
-	t, err := clipboard.ReadAll()
+	if err := c.svc.checkRate(c.peer); err != nil {
+		return err
+	}
+	t, err := c.svc.call("Paste", c.peer, c.svc.backend.ReadAll)
 	if c.cli.Debug {
-		log.Printf("lemonade Paste request received len: %d, error: '%+v'", len(t), err)
+		log.Printf("lemonade Paste request from '%s' received len: %d, error: '%+v'", c.peer, len(t), err)
+	}
+	if err != nil {
+		return err
 	}
-	*resp = t
+	*resp, _, err = c.svc.applyPolicy("Paste", c.peer, t)
 	return err
 }
@@ -0,0 +1,294 @@
+package lemon
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"time"
+)
+
+// Limits of rpc messages enforced while they are read, so oversized requests are rejected before they are buffered.
+const (
+	maxRequestHeader = 1 << 12 // rpc header: method name and sequence number
+	maxRequestArgs   = 1 << 16 // arguments of calls which do not carry clipboard content
+	requestOverhead  = 1 << 12 // encoding overhead on top of content size
+	jsonExpansion    = 6       // the longest JSON escape of a single byte: \u0000
+)
+
+// rejectLinger is how long the rest of rejected request is read before connection is closed. Client could still be
+// sending it and closing connection under it would lose the error reply.
+var rejectLinger = time.Second
+
+// gobLimitReader follows gob message framing and fails as soon as message declares length above limit. Gob decoder
+// allocates buffer for the whole message before reading it, so limit has to be checked here.
+type gobLimitReader struct {
+	r      *bufio.Reader
+	limit  int // 0 - unlimited
+	left   uint64
+	prefix []byte // length prefix read so far
+	err    error
+}
+
+// Read passes body of the message through, length prefix is read byte by byte, so decoder never gets more than
+// the current message and limit of the next one could be set in between.
+func (lr *gobLimitReader) Read(p []byte) (int, error) {
+	if lr.err != nil {
+		return 0, lr.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if lr.left > 0 {
+		if uint64(len(p)) > lr.left {
+			p = p[:lr.left]
+		}
+		n, err := lr.r.Read(p)
+		lr.left -= uint64(n)
+		return n, err
+	}
+
+	b, err := lr.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	lr.prefix = append(lr.prefix, b)
+	size, done := gobUint(lr.prefix)
+	if !done {
+		p[0] = b
+		return 1, nil
+	}
+	lr.prefix = lr.prefix[:0]
+	if lr.limit > 0 && size > uint64(lr.limit) {
+		lr.left = size
+		lr.err = fmt.Errorf("%w: request is %d bytes, limit is %d bytes", ErrTooLarge, size, lr.limit)
+		return 0, lr.err
+	}
+	lr.left = size
+	p[0] = b
+	return 1, nil
+}
+
+// ReadByte keeps gob decoder from adding its own buffering.
+func (lr *gobLimitReader) ReadByte() (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(lr, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// discard reads and drops what is left of rejected message.
+func (lr *gobLimitReader) discard() {
+	if lr.err != nil && lr.left > 0 {
+		_, _ = io.CopyN(ioutil.Discard, lr.r, int64(lr.left))
+		lr.left = 0
+	}
+}
+
+// gobUint decodes gob unsigned integer: either single byte below 0x80 or negated byte count followed by big endian
+// bytes. Malformed prefix is left to decoder to complain about.
+func gobUint(buf []byte) (uint64, bool) {
+	if buf[0] < 0x80 {
+		return uint64(buf[0]), true
+	}
+	n := -int(int8(buf[0]))
+	if n > 8 {
+		return 0, true
+	}
+	if len(buf) < n+1 {
+		return 0, false
+	}
+	var x uint64
+	for _, b := range buf[1 : n+1] {
+		x = x<<8 | uint64(b)
+	}
+	return x, true
+}
+
+// gobServerCodec is net/rpc gob codec limiting size of every request according to called method.
+type gobServerCodec struct {
+	svc    *Service
+	peer   net.Addr
+	conn   net.Conn
+	lr     *gobLimitReader
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	method string
+	closed bool
+}
+
+func (s *Service) newGobCodec(conn net.Conn) rpc.ServerCodec {
+	lr := &gobLimitReader{r: bufio.NewReader(conn)}
+	buf := bufio.NewWriter(conn)
+	return &gobServerCodec{
+		svc:    s,
+		peer:   conn.RemoteAddr(),
+		conn:   conn,
+		lr:     lr,
+		dec:    gob.NewDecoder(lr),
+		enc:    gob.NewEncoder(buf),
+		encBuf: buf,
+	}
+}
+
+func (c *gobServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	c.lr.limit = maxRequestHeader
+	err := c.dec.Decode(r)
+	c.method = r.ServiceMethod
+	return err
+}
+
+func (c *gobServerCodec) ReadRequestBody(body interface{}) error {
+	c.lr.limit = c.svc.argsLimit(c.method)
+	err := c.dec.Decode(body)
+	if err != nil && c.lr.err != nil {
+		log.Printf("lemonade %s request from '%s' rejected: %s", c.method, c.peer, err.Error())
+	}
+	return err
+}
+
+func (c *gobServerCodec) WriteResponse(r *rpc.Response, body interface{}) (err error) {
+	if err = c.enc.Encode(r); err != nil {
+		if c.encBuf.Flush() == nil {
+			log.Println("rpc: gob error encoding response:", err)
+			c.Close()
+		}
+		return
+	}
+	if err = c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			log.Println("rpc: gob error encoding body:", err)
+			c.Close()
+		}
+		return
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *gobServerCodec) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.lr.err != nil && c.conn.SetReadDeadline(time.Now().Add(rejectLinger)) == nil {
+		c.lr.discard()
+	}
+	return c.conn.Close()
+}
+
+// argsLimit returns maximum size of encoded arguments of method, 0 - unlimited.
+func (s *Service) argsLimit(method string) int {
+	limit := 0
+	switch method {
+	case "Clipboard.Copy", "Clipboard.CopyTyped":
+		limit = s.cli.MaxCopySize
+	case "URI.Open":
+		limit = s.cli.MaxURISize
+	case "Clipboard.CopyChunk":
+		limit = MaxChunk
+	default:
+		return maxRequestArgs
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return limit + requestOverhead
+}
+
+// jsonLimit returns maximum size of JSON-RPC request, 0 - unlimited. Method is only known after the whole request
+// is read, so the largest of configured limits is used for all of them and it has to allow for escaped content. When
+// only URI size is limited, larger content has to be copied in chunks.
+func (s *Service) jsonLimit() int {
+	limit := 0
+	for _, l := range []int{s.cli.MaxCopySize, s.cli.MaxURISize} {
+		if l > limit {
+			limit = l
+		}
+	}
+	if limit == 0 {
+		return 0
+	}
+	if limit < MaxChunk {
+		limit = MaxChunk
+	}
+	return JSONSize(limit)
+}
+
+// JSONSize returns maximum size of JSON request carrying content of size bytes, 0 - unlimited.
+func JSONSize(size int) int {
+	if size <= 0 {
+		return 0
+	}
+	return size*jsonExpansion + requestOverhead
+}
+
+// countingReader fails when more than limit bytes are read since the last reset.
+type countingReader struct {
+	r     io.Reader
+	limit int
+	count int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	if cr.count > cr.limit {
+		return 0, fmt.Errorf("%w: request is larger than %d bytes", ErrTooLarge, cr.limit)
+	}
+	if rest := cr.limit + 1 - cr.count; len(p) > rest {
+		p = p[:rest]
+	}
+	n, err := cr.r.Read(p)
+	cr.count += n
+	return n, err
+}
+
+// jsonServerCodec resets request size counter every time next request is about to be read. Decoder reads ahead,
+// so counted bytes are not exactly the ones of a single request, limit is generous enough for that.
+type jsonServerCodec struct {
+	rpc.ServerCodec
+	cr *countingReader
+}
+
+func (s *Service) newJSONCodec(conn net.Conn) rpc.ServerCodec {
+	limit := s.jsonLimit()
+	if limit == 0 {
+		return jsonrpc.NewServerCodec(conn)
+	}
+	cr := &countingReader{r: conn, limit: limit}
+	rwc := struct {
+		io.Reader
+		io.Writer
+		io.Closer
+	}{cr, conn, conn}
+	return &jsonServerCodec{ServerCodec: jsonrpc.NewServerCodec(rwc), cr: cr}
+}
+
+func (c *jsonServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	c.cr.count = 0
+	return c.ServerCodec.ReadRequestHeader(r)
+}
+
+// trackingCodec tells connection when calls start and finish. Rpc server answers every request which body was read,
+// even if it could not be decoded.
+type trackingCodec struct {
+	rpc.ServerCodec
+	ct CallTracker
+}
+
+func (c *trackingCodec) ReadRequestBody(body interface{}) error {
+	err := c.ServerCodec.ReadRequestBody(body)
+	c.ct.CallStarted()
+	return err
+}
+
+func (c *trackingCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	err := c.ServerCodec.WriteResponse(r, body)
+	c.ct.CallFinished()
+	return err
+}
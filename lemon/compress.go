@@ -0,0 +1,125 @@
+package lemon
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+const defaultCompressThreshold = 1024
+
+// CheckCompression validates compression method.
+func CheckCompression(method string) error {
+	switch strings.ToLower(method) {
+	case "", param.CompressionNone, param.CompressionGzip, param.CompressionFlate:
+		return nil
+	default:
+		return fmt.Errorf("unknown compression '%s', should be one of %s, %s or %s",
+			method, param.CompressionNone, param.CompressionGzip, param.CompressionFlate)
+	}
+}
+
+// IsCompressed checks if compression method actually changes content.
+func IsCompressed(method string) bool {
+	m := strings.ToLower(method)
+	return len(m) != 0 && m != param.CompressionNone
+}
+
+// NewCompressor returns writer compressing everything written to w with method.
+func NewCompressor(w io.Writer, method string) (io.WriteCloser, error) {
+	switch strings.ToLower(method) {
+	case param.CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case param.CompressionFlate:
+		return flate.NewWriter(w, flate.DefaultCompression)
+	default:
+		return nil, CheckCompression(method)
+	}
+}
+
+// NewDecompressor returns reader decompressing content of r compressed with method.
+func NewDecompressor(r io.Reader, method string) (io.ReadCloser, error) {
+	switch strings.ToLower(method) {
+	case param.CompressionGzip:
+		return gzip.NewReader(r)
+	case param.CompressionFlate:
+		return flate.NewReader(r), nil
+	default:
+		return nil, CheckCompression(method)
+	}
+}
+
+// Compress returns data compressed with method and method actually used. Data smaller than threshold, or which does
+// not get any smaller, is returned as is with empty method.
+func Compress(data []byte, method string, threshold int, debug bool) ([]byte, string, error) {
+	if !IsCompressed(method) || len(data) < threshold {
+		return data, "", nil
+	}
+
+	start := time.Now()
+	var buf bytes.Buffer
+	w, err := NewCompressor(&buf, method)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	if debug {
+		LogCompression("compressed", method, len(data), buf.Len(), time.Since(start))
+	}
+	if buf.Len() >= len(data) {
+		return data, "", nil
+	}
+	return buf.Bytes(), strings.ToLower(method), nil
+}
+
+// Decompress returns data compressed with method (if any), decompressed content larger than limit is rejected.
+func Decompress(data []byte, method string, limit int, debug bool) ([]byte, error) {
+	if !IsCompressed(method) {
+		return data, nil
+	}
+
+	start := time.Now()
+	r, err := NewDecompressor(bytes.NewReader(data), method)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var src io.Reader = r
+	if limit > 0 {
+		src = io.LimitReader(r, int64(limit)+1)
+	}
+	out, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress %s content: %w", method, err)
+	}
+	if err := checkSize("decompressed content", len(out), limit); err != nil {
+		return nil, err
+	}
+	if debug {
+		LogCompression("decompressed", method, len(out), len(data), time.Since(start))
+	}
+	return out, nil
+}
+
+// LogCompression reports compression ratio and time spent.
+func LogCompression(what, method string, size, compressed int, d time.Duration) {
+	ratio := 100.0
+	if size > 0 {
+		ratio = float64(compressed) * 100 / float64(size)
+	}
+	log.Printf("lemonade %s %d bytes with %s: %d bytes (%.1f%%) in %s", what, size, method, compressed, ratio, d)
+}
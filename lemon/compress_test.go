@@ -0,0 +1,149 @@
+package lemon
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+func TestCompress(t *testing.T) {
+
+	data := bytes.Repeat([]byte("clipboard log line\n"), 1000)
+
+	for _, method := range []string{param.CompressionGzip, param.CompressionFlate, "GZIP"} {
+		out, used, err := Compress(data, method, 100, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != strings.ToLower(method) || len(out) >= len(data) {
+			t.Errorf("Expected content to be compressed with '%s', but got '%s' %d bytes", method, used, len(out))
+		}
+		back, err := Decompress(out, used, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(back, data) {
+			t.Errorf("Expected decompressed content to match original for '%s'", method)
+		}
+		if _, err := Decompress(out, used, len(data)-1, false); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("Expected decompressed content over limit to be rejected for '%s', but got '%v'", method, err)
+		}
+	}
+
+	// below threshold, disabled or incompressible content is sent as is
+	assert := func(data []byte, method string, threshold int) {
+		t.Helper()
+		out, used, err := Compress(data, method, threshold, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(used) != 0 || !bytes.Equal(out, data) {
+			t.Errorf("Expected content to stay uncompressed with '%s' and threshold %d, but got '%s'", method, threshold, used)
+		}
+	}
+	assert(data, param.CompressionGzip, len(data)+1)
+	assert(data, param.CompressionNone, 0)
+	assert(data, "", 0)
+	random := make([]byte, 4096)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	assert(random, param.CompressionGzip, 0)
+
+	if _, err := Decompress(data, param.CompressionGzip, 0, false); err == nil {
+		t.Errorf("Expected error decompressing garbage")
+	}
+	if err := CheckCompression("zstd"); err == nil {
+		t.Errorf("Expected error for unknown compression")
+	}
+}
+
+func TestServiceCompression(t *testing.T) {
+
+	m := newMemClipboard()
+	c := New()
+	c.CompressThreshold = 64
+	svc := NewService(c, m)
+
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	text := strings.Repeat("compressible text ", 100)
+	data, used, err := Compress([]byte(text), param.CompressionFlate, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &param.CopyTypedParam{Formats: []param.ClipboardFormat{{MIME: param.MIMEText, Data: data, Compression: used}}}
+	if err := rc.Call("Clipboard.CopyTyped", p, dummy); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.ReadAll(); got != text {
+		t.Errorf("Expected decompressed text in clipboard, but got %d bytes", len(got))
+	}
+
+	// compressed only when client asks for it
+	var f param.ClipboardFormat
+	if err := rc.Call("Clipboard.PasteTyped", &param.PasteTypedParam{Types: []string{param.MIMEText}}, &f); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Compression) != 0 || string(f.Data) != text {
+		t.Errorf("Expected uncompressed text, but got '%s' %d bytes", f.Compression, len(f.Data))
+	}
+	f = param.ClipboardFormat{}
+	if err := rc.Call("Clipboard.PasteTyped", &param.PasteTypedParam{Types: []string{param.MIMEText}, Compression: param.CompressionGzip}, &f); err != nil {
+		t.Fatal(err)
+	}
+	if back, err := Decompress(f.Data, f.Compression, 0, false); f.Compression != param.CompressionGzip || err != nil || string(back) != text {
+		t.Errorf("Expected gzip compressed text, but got '%s' %d bytes, error '%v'", f.Compression, len(f.Data), err)
+	}
+
+	// chunked transfer checksum is of decompressed content
+	var info param.TransferInfo
+	if err := rc.Call("Clipboard.PasteBegin", &param.PasteTypedParam{Types: []string{param.MIMEText}, Compression: param.CompressionGzip}, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Compression != param.CompressionGzip || info.Size >= len(text) || info.Hash != HashBytes([]byte(text)) {
+		t.Errorf("Unexpected transfer info %+v", info)
+	}
+
+	if err := rc.Call("Clipboard.CopyBegin", &param.TransferParam{Size: -1, Compression: used}, dummy); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Call("Clipboard.CopyChunk", data, dummy); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Call("Clipboard.CopyEnd", HashBytes([]byte(text)), dummy); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServiceCompressionBomb(t *testing.T) {
+
+	saved := uploadCap
+	uploadCap = 1 << 20
+	defer func() { uploadCap = saved }()
+
+	m := newMemClipboard()
+	svc := NewService(New(), m)
+
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	// few KB expanding above hard limit, copy size is not limited
+	data, used, err := Compress(make([]byte, 4<<20), param.CompressionGzip, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &param.CopyTypedParam{Formats: []param.ClipboardFormat{{MIME: param.MIMEText, Data: data, Compression: used}}}
+	if err := rc.Call("Clipboard.CopyTyped", p, dummy); err == nil || !strings.Contains(err.Error(), ErrTooLarge.Error()) {
+		t.Errorf("Expected %d compressed bytes to be rejected, but got '%v'", len(data), err)
+	}
+	if got, _ := m.ReadAll(); len(got) != 0 {
+		t.Errorf("Expected clipboard to stay empty, but got %d bytes", len(got))
+	}
+}
@@ -0,0 +1,420 @@
+package lemon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Character encodings of copied input and pasted output, clipboard text is always UTF-8.
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16       = "utf-16" // byte order from BOM or little endian, output starts with BOM
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingWindows1252 = "windows-1252"
+	EncodingLatin1      = "latin1"
+)
+
+// What to do with text which could not be converted.
+const (
+	EncodingErrorsReplace = "replace" // use U+FFFD when decoding and '?' when encoding
+	EncodingErrorsFail    = "fail"
+)
+
+// ErrEncoding is returned when text could not be converted and replacement is not allowed.
+var ErrEncoding = errors.New("invalid character encoding")
+
+var encodingAliases = map[string]string{
+	"":           EncodingUTF8,
+	"utf8":       EncodingUTF8,
+	"utf16":      EncodingUTF16,
+	"utf16le":    EncodingUTF16LE,
+	"utf16be":    EncodingUTF16BE,
+	"cp1252":     EncodingWindows1252,
+	"latin-1":    EncodingLatin1,
+	"iso-8859-1": EncodingLatin1,
+}
+
+// windows-1252 differs from latin1 in 0x80-0x9F range, undefined bytes are mapped to C1 controls as latin1 does
+var cp1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021, 0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014, 0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+func normalizeEncoding(enc string) string {
+	enc = strings.ToLower(enc)
+	if len(enc) == 0 {
+		return EncodingUTF8
+	}
+	if alias, ok := encodingAliases[enc]; ok {
+		return alias
+	}
+	return enc
+}
+
+// CheckEncoding validates character encoding and error handling.
+func CheckEncoding(enc, errs string) error {
+	switch normalizeEncoding(enc) {
+	case EncodingUTF8, EncodingUTF16, EncodingUTF16LE, EncodingUTF16BE, EncodingWindows1252, EncodingLatin1:
+	default:
+		return fmt.Errorf("unknown encoding '%s', should be one of %s, %s, %s, %s, %s or %s", enc,
+			EncodingUTF8, EncodingUTF16, EncodingUTF16LE, EncodingUTF16BE, EncodingWindows1252, EncodingLatin1)
+	}
+	switch strings.ToLower(errs) {
+	case "", EncodingErrorsReplace, EncodingErrorsFail:
+		return nil
+	default:
+		return fmt.Errorf("unknown encoding errors handling '%s', should be %s or %s", errs, EncodingErrorsReplace, EncodingErrorsFail)
+	}
+}
+
+// converter keeps state of conversion done in parts: incomplete sequence at the end of one part is carried to
+// the next one.
+type converter struct {
+	enc   string
+	fail  bool
+	start bool // BOM is not processed yet
+	carry []byte
+	off   int // input bytes processed, for error messages
+}
+
+func newConverter(enc, errs string) *converter {
+	return &converter{enc: normalizeEncoding(enc), fail: strings.EqualFold(errs, EncodingErrorsFail), start: true}
+}
+
+func (cv *converter) invalid(what string, pos int) error {
+	if cv.fail {
+		return fmt.Errorf("%w: %s at byte %d", ErrEncoding, what, cv.off+pos)
+	}
+	return nil
+}
+
+// decodeUTF8 validates UTF-8 replacing invalid sequences.
+func (cv *converter) decodeUTF8(data []byte, final bool, out *bytes.Buffer) error {
+	for i := 0; i < len(data); {
+		if c := data[i]; c < utf8.RuneSelf {
+			out.WriteByte(c)
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size <= 1 {
+			if !final && !utf8.FullRune(data[i:]) {
+				cv.carry = append(cv.carry[:0], data[i:]...)
+				return nil
+			}
+			if err := cv.invalid("invalid UTF-8", i); err != nil {
+				return err
+			}
+		}
+		out.WriteRune(r)
+		i += size
+	}
+	return nil
+}
+
+func (cv *converter) decodeUTF16(data []byte, final bool, out *bytes.Buffer) error {
+	be := cv.enc == EncodingUTF16BE
+	for i := 0; i < len(data); i += 2 {
+		if i+1 == len(data) {
+			if !final {
+				cv.carry = append(cv.carry[:0], data[i:]...)
+				return nil
+			}
+			if err := cv.invalid("truncated UTF-16", i); err != nil {
+				return err
+			}
+			out.WriteRune(utf8.RuneError)
+			return nil
+		}
+		u := rune(data[i]) | rune(data[i+1])<<8
+		if be {
+			u = rune(data[i])<<8 | rune(data[i+1])
+		}
+		if !utf16.IsSurrogate(u) {
+			out.WriteRune(u)
+			continue
+		}
+		if u < 0xDC00 {
+			if i+3 >= len(data) && !final {
+				cv.carry = append(cv.carry[:0], data[i:]...)
+				return nil
+			}
+			if i+3 < len(data) {
+				l := rune(data[i+2]) | rune(data[i+3])<<8
+				if be {
+					l = rune(data[i+2])<<8 | rune(data[i+3])
+				}
+				if r := utf16.DecodeRune(u, l); r != utf8.RuneError {
+					out.WriteRune(r)
+					i += 2
+					continue
+				}
+			}
+		}
+		if err := cv.invalid("unpaired UTF-16 surrogate", i); err != nil {
+			return err
+		}
+		out.WriteRune(utf8.RuneError)
+	}
+	return nil
+}
+
+// decode converts part of input to UTF-8.
+func (cv *converter) decode(p []byte, final bool) ([]byte, error) {
+
+	data := append(cv.carry, p...)
+	cv.carry = nil
+
+	if cv.start {
+		if len(data) < 2 && !final {
+			cv.carry = data
+			return nil, nil
+		}
+		cv.start = false
+		bom := 0
+		switch {
+		case bytes.HasPrefix(data, []byte{0xFF, 0xFE}) && cv.enc != EncodingUTF16BE && cv.enc != EncodingWindows1252 && cv.enc != EncodingLatin1:
+			cv.enc, bom = EncodingUTF16LE, 2
+		case bytes.HasPrefix(data, []byte{0xFE, 0xFF}) && cv.enc != EncodingUTF16LE && cv.enc != EncodingWindows1252 && cv.enc != EncodingLatin1:
+			cv.enc, bom = EncodingUTF16BE, 2
+		case cv.enc == EncodingUTF16:
+			cv.enc = EncodingUTF16LE
+		}
+		data = data[bom:]
+		cv.off += bom
+	}
+
+	var (
+		out bytes.Buffer
+		err error
+	)
+	out.Grow(len(data))
+	switch cv.enc {
+	case EncodingUTF16LE, EncodingUTF16BE:
+		err = cv.decodeUTF16(data, final, &out)
+	case EncodingWindows1252, EncodingLatin1:
+		for _, c := range data {
+			r := rune(c)
+			if c >= 0x80 && c < 0xA0 && cv.enc == EncodingWindows1252 {
+				r = cp1252[c-0x80]
+			}
+			out.WriteRune(r)
+		}
+	default:
+		err = cv.decodeUTF8(data, final, &out)
+	}
+	cv.off += len(data) - len(cv.carry)
+	return out.Bytes(), err
+}
+
+// encodeRune appends r in output encoding.
+func (cv *converter) encodeRune(r rune, pos int, out *bytes.Buffer) error {
+	switch cv.enc {
+	case EncodingUTF16, EncodingUTF16LE, EncodingUTF16BE:
+		units := []uint16{uint16(r)}
+		if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+			units = []uint16{uint16(r1), uint16(r2)}
+		}
+		for _, u := range units {
+			if cv.enc == EncodingUTF16BE {
+				out.WriteByte(byte(u >> 8))
+				out.WriteByte(byte(u))
+			} else {
+				out.WriteByte(byte(u))
+				out.WriteByte(byte(u >> 8))
+			}
+		}
+		return nil
+	case EncodingWindows1252, EncodingLatin1:
+		if r < 0x80 || r >= 0xA0 && r < 0x100 || r < 0xA0 && cv.enc == EncodingLatin1 {
+			out.WriteByte(byte(r))
+			return nil
+		}
+		if cv.enc == EncodingWindows1252 {
+			for i, c := range cp1252 {
+				if c == r {
+					out.WriteByte(byte(0x80 + i))
+					return nil
+				}
+			}
+		}
+		if err := cv.invalid(fmt.Sprintf("character %U not representable in %s", r, cv.enc), pos); err != nil {
+			return err
+		}
+		out.WriteByte('?')
+		return nil
+	default:
+		out.WriteRune(r)
+		return nil
+	}
+}
+
+// encode converts part of UTF-8 text to output encoding.
+func (cv *converter) encode(p []byte, final bool) ([]byte, error) {
+
+	var out bytes.Buffer
+	if cv.start {
+		cv.start = false
+		if cv.enc == EncodingUTF16 {
+			out.Write([]byte{0xFF, 0xFE})
+		}
+	}
+
+	// validate input first
+	data := append(cv.carry, p...)
+	cv.carry = nil
+	var text bytes.Buffer
+	if err := cv.decodeUTF8(data, final, &text); err != nil {
+		return nil, err
+	}
+	if cv.enc == EncodingUTF8 {
+		cv.off += len(data) - len(cv.carry)
+		return text.Bytes(), nil
+	}
+
+	out.Grow(text.Len())
+	b := text.Bytes()
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		if err := cv.encodeRune(r, i, &out); err != nil {
+			return nil, err
+		}
+		i += size
+	}
+	cv.off += len(data) - len(cv.carry)
+	return out.Bytes(), nil
+}
+
+// Decode converts input in encoding to UTF-8 text.
+func Decode(data []byte, enc, errs string) (string, error) {
+	b, err := newConverter(enc, errs).decode(data, true)
+	return string(b), err
+}
+
+// Encode converts UTF-8 text to encoding.
+func Encode(text, enc, errs string) ([]byte, error) {
+	return newConverter(enc, errs).encode([]byte(text), true)
+}
+
+type decodeReader struct {
+	r   io.Reader
+	cv  *converter
+	buf []byte
+	out []byte
+	err error
+}
+
+// NewDecodeReader returns reader converting content of r in encoding to UTF-8.
+func NewDecodeReader(r io.Reader, enc, errs string) io.Reader {
+	return &decodeReader{r: r, cv: newConverter(enc, errs), buf: make([]byte, 32*1024)}
+}
+
+func (d *decodeReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		n, err := d.r.Read(d.buf)
+		final := err == io.EOF
+		if err != nil && !final {
+			return 0, err
+		}
+		if d.out, err = d.cv.decode(d.buf[:n], final); err != nil {
+			d.out, d.err = nil, err
+			return 0, err
+		}
+		if final {
+			d.err = io.EOF
+		}
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// Len reports size of content left to read when it is known in advance, which is only possible for UTF-8 input
+// of known size. Otherwise it returns -1.
+func (d *decodeReader) Len() int {
+	if d.cv.enc != EncodingUTF8 || d.err != nil {
+		return -1
+	}
+	size := InputSize(d.r)
+	if size < 0 {
+		return -1
+	}
+	return size + len(d.out) + len(d.cv.carry)
+}
+
+type encodeWriter struct {
+	w  io.Writer
+	cv *converter
+}
+
+// NewEncodeWriter returns writer converting UTF-8 text to encoding, it has to be closed to flush incomplete input.
+func NewEncodeWriter(w io.Writer, enc, errs string) io.WriteCloser {
+	return &encodeWriter{w: w, cv: newConverter(enc, errs)}
+}
+
+func (e *encodeWriter) Write(p []byte) (int, error) {
+	out, err := e.cv.encode(p, false)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := e.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (e *encodeWriter) Close() error {
+	out, err := e.cv.encode(nil, true)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(out)
+	return err
+}
+
+// ConvertsEncoding checks if text is converted at all. Unless encoding or its errors handling is given explicitly
+// content is passed as is, so even invalid UTF-8 reaches clipboard untouched.
+func (c *CLI) ConvertsEncoding() bool {
+	return len(c.Encoding) > 0 || len(c.EncodingErrors) > 0
+}
+
+// DecodeInput returns reader converting copied input from configured encoding to UTF-8.
+func (c *CLI) DecodeInput(r io.Reader) io.Reader {
+	if !c.ConvertsEncoding() {
+		return r
+	}
+	return NewDecodeReader(r, c.Encoding, c.EncodingErrors)
+}
+
+// EncodeOutput returns writer converting pasted text to configured encoding.
+func (c *CLI) EncodeOutput(w io.Writer) io.WriteCloser {
+	if !c.ConvertsEncoding() {
+		return nopCloser{w}
+	}
+	return NewEncodeWriter(w, c.Encoding, c.EncodingErrors)
+}
+
+// EncodeText converts pasted text to configured encoding.
+func (c *CLI) EncodeText(text string) ([]byte, error) {
+	if !c.ConvertsEncoding() {
+		return []byte(text), nil
+	}
+	return Encode(text, c.Encoding, c.EncodingErrors)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,198 @@
+package lemon
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecode(t *testing.T) {
+	assert := func(data []byte, enc, expected string) {
+		t.Helper()
+		got, err := Decode(data, enc, EncodingErrorsFail)
+		if err != nil {
+			t.Fatalf("Unexpected error decoding % x from %s: %s", data, enc, err)
+		}
+		if got != expected {
+			t.Errorf("Decoding % x from %s - expected %q, but got %q", data, enc, expected, got)
+		}
+	}
+
+	assert([]byte("plain"), EncodingUTF8, "plain")
+	assert([]byte("h\x00i\x00"), EncodingUTF16LE, "hi")
+	assert([]byte("\x00h\x00i"), EncodingUTF16BE, "hi")
+	assert([]byte("h\x00i\x00"), EncodingUTF16, "hi")
+	assert([]byte("\x3d\xd8\x00\xde"), "UTF16LE", "\U0001F600")
+
+	// BOM is detected regardless of requested encoding unless it contradicts it
+	assert([]byte("\xff\xfeh\x00i\x00"), EncodingUTF8, "hi")
+	assert([]byte("\xfe\xff\x00h\x00i"), EncodingUTF8, "hi")
+	assert([]byte("\xfe\xff\x00h\x00i"), EncodingUTF16, "hi")
+	assert([]byte("\xff\xfeh\x00"), EncodingUTF16LE, "h")
+	assert([]byte("\xff\xfe"), EncodingLatin1, "ÿþ")
+
+	assert([]byte("caf\xe9 \x80\x99"), EncodingWindows1252, "café €™")
+	assert([]byte("caf\xe9 \x80\x81"), "cp1252", "café €\u0081")
+	assert([]byte("caf\xe9 \x80"), "ISO-8859-1", "café \u0080")
+}
+
+func TestEncode(t *testing.T) {
+	assert := func(text, enc string, expected []byte) {
+		t.Helper()
+		got, err := Encode(text, enc, EncodingErrorsFail)
+		if err != nil {
+			t.Fatalf("Unexpected error encoding %q to %s: %s", text, enc, err)
+		}
+		if !bytes.Equal(got, expected) {
+			t.Errorf("Encoding %q to %s - expected % x, but got % x", text, enc, expected, got)
+		}
+	}
+
+	assert("hi", EncodingUTF8, []byte("hi"))
+	assert("hi", EncodingUTF16LE, []byte("h\x00i\x00"))
+	assert("hi", EncodingUTF16BE, []byte("\x00h\x00i"))
+	assert("hi", EncodingUTF16, []byte("\xff\xfeh\x00i\x00"))
+	assert("\U0001F600", EncodingUTF16BE, []byte("\xd8\x3d\xde\x00"))
+	assert("café €™", EncodingWindows1252, []byte("caf\xe9 \x80\x99"))
+	assert("café \u0080", EncodingLatin1, []byte("caf\xe9 \x80"))
+}
+
+func TestEncodingErrors(t *testing.T) {
+
+	if s, err := Decode([]byte("a\xffb\xe2\x82"), EncodingUTF8, EncodingErrorsReplace); err != nil || s != "a�b��" {
+		t.Errorf("Expected invalid UTF-8 to be replaced, but got %q, %v", s, err)
+	}
+	if s, err := Decode([]byte("a\x00\x00\xdc\x01"), EncodingUTF16LE, EncodingErrorsReplace); err != nil || s != "a��" {
+		t.Errorf("Expected unpaired surrogate and odd byte to be replaced, but got %q, %v", s, err)
+	}
+	if b, err := Encode("€ и ½", EncodingLatin1, EncodingErrorsReplace); err != nil || string(b) != "? ? \xbd" {
+		t.Errorf("Expected unrepresentable characters to be replaced, but got % x, %v", b, err)
+	}
+
+	assert := func(err error, expected string) {
+		t.Helper()
+		if !errors.Is(err, ErrEncoding) {
+			t.Errorf("Expected encoding error, but got '%v'", err)
+			return
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to contain '%s', but got '%s'", expected, err.Error())
+		}
+	}
+
+	_, err := Decode([]byte("ab\xffc"), EncodingUTF8, EncodingErrorsFail)
+	assert(err, "invalid UTF-8 at byte 2")
+	_, err = Decode([]byte("\xff\xfea\x00\x00\xdc"), EncodingUTF8, EncodingErrorsFail)
+	assert(err, "at byte 4")
+	_, err = Encode("abc\xff", EncodingUTF16LE, EncodingErrorsFail)
+	assert(err, "invalid UTF-8 at byte 3")
+	_, err = Encode("€ и", EncodingWindows1252, EncodingErrorsFail)
+	assert(err, "U+0438 not representable in windows-1252")
+}
+
+func TestEncodingStreams(t *testing.T) {
+
+	text := strings.Repeat("línea \U0001F600 €\n", 100)
+
+	// conversion state is kept when sequences are split between reads and writes
+	for _, enc := range []string{EncodingUTF8, EncodingUTF16, EncodingUTF16BE} {
+		data, err := Encode(text, enc, EncodingErrorsFail)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		w := NewEncodeWriter(&buf, enc, EncodingErrorsFail)
+		for _, c := range []byte(text) {
+			if _, err := w.Write([]byte{c}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("Unexpected result of writing byte by byte in %s", enc)
+		}
+
+		got, err := ioutil.ReadAll(NewDecodeReader(iotest.OneByteReader(bytes.NewReader(data)), enc, EncodingErrorsFail))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != text {
+			t.Errorf("Unexpected result of reading byte by byte in %s", enc)
+		}
+	}
+
+	// incomplete sequence at the end is reported when stream is over
+	w := NewEncodeWriter(ioutil.Discard, EncodingUTF16LE, EncodingErrorsFail)
+	if _, err := w.Write([]byte("ok\xe2\x82")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); !errors.Is(err, ErrEncoding) {
+		t.Errorf("Expected encoding error on close, but got '%v'", err)
+	}
+	if _, err := ioutil.ReadAll(NewDecodeReader(strings.NewReader("h\x00i"), EncodingUTF16LE, EncodingErrorsFail)); !errors.Is(err, ErrEncoding) {
+		t.Errorf("Expected encoding error for odd length input, but got '%v'", err)
+	}
+}
+
+func TestCLIEncoding(t *testing.T) {
+
+	c := New()
+	if err := c.ParseFlags([]string{"lemonade", "paste", "--encoding=UTF-16BE", "--encoding-errors=fail"}, true); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := c.EncodeOutput(&buf)
+	if _, err := w.Write([]byte("hi")); err != nil || w.Close() != nil || buf.String() != "\x00h\x00i" {
+		t.Errorf("Unexpected encoded output % x, %v", buf.Bytes(), err)
+	}
+
+	// content is passed as is by default, even invalid UTF-8
+	invalid := "a\xffb\xfe\xff"
+	c = New()
+	if err := c.ParseFlags([]string{"lemonade", "copy"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if c.ConvertsEncoding() {
+		t.Errorf("Expected no conversion by default")
+	}
+	if data, err := ioutil.ReadAll(c.DecodeInput(strings.NewReader(invalid))); err != nil || string(data) != invalid {
+		t.Errorf("Expected input to be passed as is, but got %q, %v", data, err)
+	}
+	buf.Reset()
+	w = c.EncodeOutput(&buf)
+	if _, err := w.Write([]byte(invalid)); err != nil || w.Close() != nil || buf.String() != invalid {
+		t.Errorf("Expected output to be passed as is, but got %q, %v", buf.String(), err)
+	}
+	if data, err := c.EncodeText(invalid); err != nil || string(data) != invalid {
+		t.Errorf("Expected text to be passed as is, but got %q, %v", data, err)
+	}
+
+	// asking for errors handling alone validates UTF-8
+	c = New()
+	if err := c.ParseFlags([]string{"lemonade", "copy", "--encoding-errors=replace"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(c.DecodeInput(strings.NewReader(invalid))); err != nil || string(data) != "a\ufffdb\ufffd\ufffd" {
+		t.Errorf("Expected invalid input to be replaced, but got %q, %v", data, err)
+	}
+
+	assert := func(args []string, expected string) {
+		t.Helper()
+		err := New().ParseFlags(append([]string{"lemonade", "copy"}, args...), true)
+		if err == nil {
+			t.Errorf("Expected error for %v", args)
+			return
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error for %v to contain '%s', but got '%s'", args, expected, err.Error())
+		}
+	}
+	assert([]string{"--encoding=koi8-r"}, "unknown encoding 'koi8-r'")
+	assert([]string{"--encoding-errors=ignore"}, "unknown encoding errors handling 'ignore'")
+}
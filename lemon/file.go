@@ -0,0 +1,211 @@
+package lemon
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const defaultOutputPerm = 0644
+
+// FileList is repeatable flag holding file names.
+type FileList []string
+
+func (l *FileList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+// Set implements flag.Value interface.
+func (l *FileList) Set(v string) error {
+	if len(v) == 0 {
+		return errors.New("empty file name")
+	}
+	*l = append(*l, v)
+	return nil
+}
+
+// InputSize returns size of content left to read from r if it is known in advance.
+func InputSize(r io.Reader) int {
+	if l, ok := r.(interface{ Len() int }); ok {
+		return l.Len()
+	}
+	if f, ok := r.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			if pos, err := f.Seek(0, io.SeekCurrent); err == nil {
+				return int(fi.Size() - pos)
+			}
+		}
+	}
+	return -1
+}
+
+// filesReader reads files one after another putting separator between them. Files are opened only when they are
+// reached, so there is never more than one open.
+type filesReader struct {
+	names []string
+	sep   string
+	pend  string // part of separator not read yet
+	cur   *os.File
+	left  int // size of content not read yet as of the time files were checked
+}
+
+// NewFilesReader returns reader of files content joined by separator. All files have to be regular ones, their
+// total size is reported by Len method.
+func NewFilesReader(names []string, sep string) (io.Reader, error) {
+	r := &filesReader{names: names, sep: sep}
+	for i, name := range names {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to copy file: %w", err)
+		}
+		if !fi.Mode().IsRegular() {
+			return nil, fmt.Errorf("unable to copy '%s': not a regular file", name)
+		}
+		r.left += int(fi.Size())
+		if i > 0 {
+			r.left += len(sep)
+		}
+	}
+	return r, nil
+}
+
+func (r *filesReader) Read(p []byte) (int, error) {
+	for {
+		if len(r.pend) > 0 {
+			n := copy(p, r.pend)
+			r.pend = r.pend[n:]
+			r.consumed(n)
+			return n, nil
+		}
+		if r.cur == nil {
+			if len(r.names) == 0 {
+				return 0, io.EOF
+			}
+			f, err := os.Open(r.names[0])
+			if err != nil {
+				return 0, fmt.Errorf("unable to copy file: %w", err)
+			}
+			r.cur, r.names = f, r.names[1:]
+		}
+		n, err := r.cur.Read(p)
+		r.consumed(n)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if len(r.names) > 0 {
+				r.pend = r.sep
+			}
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (r *filesReader) consumed(n int) {
+	if r.left -= n; r.left < 0 {
+		// file grew since it was checked
+		r.left = 0
+	}
+}
+
+// Len reports size of content left to read.
+func (r *filesReader) Len() int {
+	return r.left
+}
+
+// ParsePerm parses octal file permissions.
+func ParsePerm(perm string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(perm, 8, 32)
+	if err != nil || mode&^uint64(os.ModePerm) != 0 {
+		return 0, fmt.Errorf("bad file permissions '%s'", perm)
+	}
+	return os.FileMode(mode), nil
+}
+
+// OutputFile is written to temporary file next to destination, which replaces destination only when Commit is
+// called, so readers never see partially written content and failed paste leaves destination intact.
+type OutputFile struct {
+	*os.File
+	path string
+	perm os.FileMode
+}
+
+// CreateOutput starts writing destination file. In append mode current content of destination is kept in front of
+// written one. Empty perm keeps permissions of existing destination, new one gets 0644.
+func CreateOutput(path string, appendMode bool, perm string) (*OutputFile, error) {
+
+	o := &OutputFile{path: path, perm: defaultOutputPerm}
+	fi, err := os.Stat(path)
+	switch {
+	case err == nil && !fi.Mode().IsRegular():
+		return nil, fmt.Errorf("unable to write '%s': not a regular file", path)
+	case err == nil:
+		o.perm = fi.Mode().Perm()
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("unable to write output: %w", err)
+	default:
+		// nothing to append to
+		appendMode = false
+	}
+	if len(perm) > 0 {
+		if o.perm, err = ParsePerm(perm); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.File, err = ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*"); err != nil {
+		return nil, fmt.Errorf("unable to write output: %w", err)
+	}
+	if appendMode {
+		if err := o.copyFrom(path); err != nil {
+			o.Abort()
+			return nil, fmt.Errorf("unable to append to '%s': %w", path, err)
+		}
+	}
+	return o, nil
+}
+
+func (o *OutputFile) copyFrom(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(o.File, f)
+	return err
+}
+
+// Commit replaces destination with written content.
+func (o *OutputFile) Commit() error {
+	err := o.Sync()
+	if cerr := o.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(o.Name(), o.perm)
+	}
+	if err == nil {
+		err = os.Rename(o.Name(), o.path)
+	}
+	if err != nil {
+		os.Remove(o.Name())
+		return fmt.Errorf("unable to write output: %w", err)
+	}
+	return nil
+}
+
+// Abort discards written content leaving destination intact.
+func (o *OutputFile) Abort() {
+	o.Close()
+	os.Remove(o.Name())
+}
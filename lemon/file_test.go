@@ -0,0 +1,181 @@
+package lemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, text string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFilesReader(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "lemonade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, b, empty := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "empty")
+	writeTestFile(t, a, "first\n")
+	writeTestFile(t, b, strings.Repeat("x", 100))
+	writeTestFile(t, empty, "")
+
+	assert := func(names []string, sep, expected string) {
+		t.Helper()
+		r, err := NewFilesReader(names, sep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := InputSize(r); size != len(expected) {
+			t.Errorf("Expected size %d, but got %d", len(expected), size)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("Expected %q, but got %q", expected, data)
+		}
+		if size := InputSize(r); size != 0 {
+			t.Errorf("Expected nothing left to read, but got %d", size)
+		}
+	}
+
+	assert([]string{a}, "---", "first\n")
+	assert([]string{a, b}, "", "first\n"+strings.Repeat("x", 100))
+	assert([]string{a, empty, a}, "--\n", "first\n--\n--\nfirst\n")
+
+	// size is known even when input is decoded
+	r, _ := NewFilesReader([]string{a, b}, "\n")
+	if size := InputSize(NewDecodeReader(r, EncodingUTF8, EncodingErrorsReplace)); size != 107 {
+		t.Errorf("Expected size of decoded files 107, but got %d", size)
+	}
+
+	if _, err := NewFilesReader([]string{a, filepath.Join(dir, "missing")}, ""); err == nil || !strings.Contains(err.Error(), "unable to copy file") {
+		t.Errorf("Expected error for missing file, but got '%v'", err)
+	}
+	if _, err := NewFilesReader([]string{dir}, ""); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Errorf("Expected error for directory, but got '%v'", err)
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "lemonade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "out")
+	write := func(text string, appendMode bool, perm string) {
+		t.Helper()
+		o, err := CreateOutput(path, appendMode, perm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := o.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert := func(expected string, perm os.FileMode) {
+		t.Helper()
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("Expected output %q, but got %q", expected, data)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS != "windows" && fi.Mode().Perm() != perm {
+			t.Errorf("Expected output permissions %s, but got %s", perm, fi.Mode().Perm())
+		}
+	}
+
+	// appending to file which does not exist yet creates it
+	write("one\n", true, "")
+	assert("one\n", 0644)
+	write("two\n", true, "0600")
+	assert("one\ntwo\n", 0600)
+	write("three\n", false, "")
+	assert("three\n", 0600)
+
+	// aborted output leaves destination intact and removes temporary file
+	o, err := CreateOutput(path, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.WriteString("partial"); err != nil {
+		t.Fatal(err)
+	}
+	o.Abort()
+	assert("three\n", 0600)
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expected only output file to be left, but got %d files", len(files))
+	}
+
+	if _, err := CreateOutput(dir, false, ""); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Errorf("Expected error for directory, but got '%v'", err)
+	}
+	if _, err := CreateOutput(path, false, "0999"); err == nil || !strings.Contains(err.Error(), "bad file permissions") {
+		t.Errorf("Expected error for bad permissions, but got '%v'", err)
+	}
+}
+
+func TestCLIFiles(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "lemonade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	writeTestFile(t, a, "a")
+	writeTestFile(t, b, "b")
+
+	c := New()
+	if err := c.ParseFlags([]string{"lemonade", "copy", "--file=" + a, "--file", b, `--file-separator=\t`}, true); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(c.DataReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a\tb" {
+		t.Errorf("Expected files to be joined by tab, but got %q", data)
+	}
+
+	assert := func(args []string, expected string) {
+		t.Helper()
+		err := New().ParseFlags(append([]string{"lemonade"}, args...), true)
+		if err == nil {
+			t.Errorf("Expected error for %v", args)
+			return
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error for %v to contain '%s', but got '%s'", args, expected, err.Error())
+		}
+	}
+	assert([]string{"copy", "--file=" + a, "text"}, "could not be used together with --file")
+	assert([]string{"copy", "--file="}, "empty file name")
+	assert([]string{"paste", "--append"}, "--append requires --output")
+	assert([]string{"paste", "--output=x", "--watch"}, "could not be used with --watch")
+	assert([]string{"paste", "--output=x", "--output-perm=rw"}, "bad file permissions 'rw'")
+}
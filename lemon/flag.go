@@ -2,9 +2,12 @@ package lemon
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/monochromegane/conflag"
@@ -18,7 +21,30 @@ func (c *CLI) ParseFlags(args []string, skip bool) error {
 	} else if !aliased {
 		args = args[:len(args)-1]
 	}
-	return c.parse(args, skip)
+	if err := c.parse(args, skip); err != nil {
+		return err
+	}
+	if len(c.Secret) == 0 {
+		c.Secret = os.Getenv(SecretEnv)
+	}
+	if err := CheckSelection(c.Selection); err != nil {
+		return err
+	}
+	if err := CheckCompression(c.Compress); err != nil {
+		return err
+	}
+	if err := CheckEncoding(c.Encoding, c.EncodingErrors); err != nil {
+		return err
+	}
+	if err := c.checkOutput(); err != nil {
+		return err
+	}
+	switch strings.ToLower(c.SyncDirection) {
+	case SyncPush, SyncPull, SyncBoth:
+		return nil
+	default:
+		return fmt.Errorf("unknown sync direction '%s', should be one of %s, %s or %s", c.SyncDirection, SyncPush, SyncPull, SyncBoth)
+	}
 }
 
 func (c *CLI) getCommand(args []string) (bool, error) {
@@ -61,6 +87,22 @@ func (c *CLI) getCommand(args []string) (bool, error) {
 			c.Cmd = CmdServer
 			del(i)
 			return aliased, nil
+		case "version":
+			c.Cmd = CmdVersion
+			del(i)
+			return aliased, nil
+		case "history":
+			c.Cmd = CmdHistory
+			del(i)
+			return aliased, nil
+		case "sync":
+			c.Cmd = CmdSync
+			del(i)
+			return aliased, nil
+		case "stat":
+			c.Cmd = CmdStat
+			del(i)
+			return aliased, nil
 		}
 	}
 
@@ -83,7 +125,7 @@ func (c *CLI) parse(args []string, skip bool) error {
 	if err != nil {
 		return err
 	}
-	if c.Cmd == CmdPaste || c.Cmd == CmdServer {
+	if c.Cmd == CmdPaste || c.Cmd == CmdServer || c.Cmd == CmdVersion || c.Cmd == CmdSync || c.Cmd == CmdStat {
 		return nil
 	}
 
@@ -100,8 +142,29 @@ func (c *CLI) parse(args []string, skip bool) error {
 		return nil
 	}
 
+	if c.Cmd == CmdHistory {
+		// entry index is optional and never comes from stdin
+		c.DataSource = arg
+		return nil
+	}
+
+	if c.Cmd == CmdCopy && len(c.Files) > 0 {
+		if arg != "" {
+			return errors.New("text to copy could not be used together with --file")
+		}
+		sep, err := strconv.Unquote(`"` + c.FileSeparator + `"`)
+		if err != nil {
+			sep = c.FileSeparator
+		}
+		c.DataReader, err = NewFilesReader(c.Files, sep)
+		return err
+	}
+
 	if arg != "" {
 		c.DataSource = arg
+	} else if c.Cmd == CmdCopy {
+		// large content is sent in chunks while it is being read
+		c.DataReader = os.Stdin
 	} else {
 		b, err := ioutil.ReadAll(os.Stdin)
 		if err != nil {
@@ -112,3 +175,46 @@ func (c *CLI) parse(args []string, skip bool) error {
 
 	return nil
 }
+
+// checkOutput validates options of paste output file.
+func (c *CLI) checkOutput() error {
+	if len(c.Output) == 0 {
+		if c.Append {
+			return errors.New("--append requires --output")
+		}
+		return nil
+	}
+	if c.Watch {
+		return errors.New("--output could not be used with --watch")
+	}
+	if len(c.OutputPerm) > 0 {
+		if _, err := ParsePerm(c.OutputPerm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegexpList is repeatable flag holding compiled regular expressions.
+type RegexpList []*regexp.Regexp
+
+func (l *RegexpList) String() string {
+	if l == nil {
+		return ""
+	}
+	s := make([]string, 0, len(*l))
+	for _, re := range *l {
+		s = append(s, re.String())
+	}
+	return strings.Join(s, ",")
+}
+
+// Set implements flag.Value interface.
+func (l *RegexpList) Set(v string) error {
+	re, err := regexp.Compile(v)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, re)
+	return nil
+}
@@ -17,7 +17,6 @@ func TestCLIParse(t *testing.T) {
 
 		// Do not check those fields
 		c.Flags = expected.Flags
-		c.ConnCh = expected.ConnCh
 
 		if !reflect.DeepEqual(expected, *c) {
 			t.Errorf("Expected:\n %+v, but got\n %+v", expected, c)
@@ -29,173 +28,503 @@ func TestCLIParse(t *testing.T) {
 	defaultAllow := "0.0.0.0/0,::/0"
 
 	assert([]string{"xdg-open", "http://example.com"}, CLI{
-		Cmd:              CmdOpen,
-		Host:             defaultHost,
-		Port:             defaultPort,
-		Allow:            defaultAllow,
-		DataSource:       "http://example.com",
-		TransLoopback:    true,
-		TransLocalfile:   true,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdOpen,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		DataSource:        "http://example.com",
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
 	})
 
 	assert([]string{"/usr/bin/xdg-open", "http://example.com"}, CLI{
-		Cmd:              CmdOpen,
-		Host:             defaultHost,
-		Port:             defaultPort,
-		Allow:            defaultAllow,
-		DataSource:       "http://example.com",
-		TransLoopback:    true,
-		TransLocalfile:   true,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdOpen,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		DataSource:        "http://example.com",
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
 	})
 
 	assert([]string{"xdg-open"}, CLI{
-		Cmd:              CmdOpen,
-		Host:             defaultHost,
-		Port:             defaultPort,
-		Allow:            defaultAllow,
-		TransLoopback:    true,
-		TransLocalfile:   true,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdOpen,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
 	})
 
 	assert([]string{"pbpaste", "--port", "1124"}, CLI{
-		Cmd:              CmdPaste,
-		Host:             defaultHost,
-		Port:             1124,
-		Allow:            defaultAllow,
-		TransLoopback:    true,
-		TransLocalfile:   true,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdPaste,
+		Host:              defaultHost,
+		Port:              1124,
+		Allow:             defaultAllow,
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
 	})
 
 	assert([]string{"/usr/bin/pbpaste", "--port", "1124"}, CLI{
-		Cmd:              CmdPaste,
-		Host:             defaultHost,
-		Port:             1124,
-		Allow:            defaultAllow,
-		TransLoopback:    true,
-		TransLocalfile:   true,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdPaste,
+		Host:              defaultHost,
+		Port:              1124,
+		Allow:             defaultAllow,
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
 	})
 
 	assert([]string{"pbcopy", "hogefuga"}, CLI{
-		Cmd:              CmdCopy,
-		Host:             defaultHost,
-		Port:             defaultPort,
-		Allow:            defaultAllow,
-		DataSource:       "hogefuga",
-		TransLoopback:    true,
-		TransLocalfile:   true,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdCopy,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		DataSource:        "hogefuga",
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
 	})
 
 	assert([]string{"/usr/bin/pbcopy", "hogefuga"}, CLI{
-		Cmd:              CmdCopy,
-		Host:             defaultHost,
-		Port:             defaultPort,
-		Allow:            defaultAllow,
-		DataSource:       "hogefuga",
-		TransLoopback:    true,
-		TransLocalfile:   true,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdCopy,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		DataSource:        "hogefuga",
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
 	})
 
 	assert([]string{"lemonade", "--host", "192.168.0.1", "--port", "1124", "open", "http://example.com"}, CLI{
-		Cmd:              CmdOpen,
-		Host:             "192.168.0.1",
-		Port:             1124,
-		Allow:            defaultAllow,
-		DataSource:       "http://example.com",
-		TransLoopback:    true,
-		TransLocalfile:   true,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdOpen,
+		Host:              "192.168.0.1",
+		Port:              1124,
+		Allow:             defaultAllow,
+		DataSource:        "http://example.com",
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
 	})
 
 	assert([]string{"lemonade", "copy", "hogefuga"}, CLI{
-		Cmd:              CmdCopy,
-		Host:             defaultHost,
-		Port:             defaultPort,
-		Allow:            defaultAllow,
-		DataSource:       "hogefuga",
-		TransLoopback:    true,
-		TransLocalfile:   true,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdCopy,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		DataSource:        "hogefuga",
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
+	})
+
+	assert([]string{"lemonade", "copy", "--encoding=utf-16", "--encoding-errors=fail", "hogefuga"}, CLI{
+		Cmd:               CmdCopy,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		DataSource:        "hogefuga",
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		Encoding:          "utf-16",
+		EncodingErrors:    "fail",
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
+	})
+
+	assert([]string{"lemonade", "copy", "--report-identity", "hogefuga"}, CLI{
+		Cmd:               CmdCopy,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		DataSource:        "hogefuga",
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		ReportIdentity:    true,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
 	})
 
 	assert([]string{"lemonade", "paste"}, CLI{
-		Cmd:              CmdPaste,
-		Host:             defaultHost,
-		Port:             defaultPort,
-		Allow:            defaultAllow,
-		TransLoopback:    true,
-		TransLocalfile:   true,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdPaste,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
 	})
 
 	assert([]string{"lemonade", "--allow", "192.168.0.0/24", "server", "--port", "1124"}, CLI{
-		Cmd:              CmdServer,
-		Host:             defaultHost,
-		Port:             1124,
-		Allow:            "192.168.0.0/24",
-		TransLoopback:    true,
-		TransLocalfile:   true,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdServer,
+		Host:              defaultHost,
+		Port:              1124,
+		Allow:             "192.168.0.0/24",
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
 	})
 
 	assert([]string{"lemonade", "open", "--trans-loopback=false"}, CLI{
-		Cmd:              CmdOpen,
-		Host:             defaultHost,
-		Port:             defaultPort,
-		Allow:            defaultAllow,
-		TransLoopback:    false,
-		TransLocalfile:   true,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdOpen,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		TransLoopback:     false,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
 	})
 
 	assert([]string{"lemonade", "open", "--trans-loopback=true"}, CLI{
-		Cmd:              CmdOpen,
-		Host:             defaultHost,
-		Port:             defaultPort,
-		Allow:            defaultAllow,
-		TransLoopback:    true,
-		TransLocalfile:   true,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdOpen,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
 	})
 
 	assert([]string{"lemonade", "open", "--trans-localfile=false"}, CLI{
-		Cmd:              CmdOpen,
-		Host:             defaultHost,
-		Port:             defaultPort,
-		Allow:            defaultAllow,
-		TransLoopback:    true,
-		TransLocalfile:   false,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdOpen,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		TransLoopback:     true,
+		TransLocalfile:    false,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
 	})
 
 	assert([]string{"lemonade", "open", "--trans-localfile=true"}, CLI{
-		Cmd:              CmdOpen,
-		Host:             defaultHost,
-		Port:             defaultPort,
-		Allow:            defaultAllow,
-		TransLoopback:    true,
-		TransLocalfile:   true,
-		TransFileTimeout: time.Second,
-		TransFilePort:    defaultPort + 1,
+		Cmd:               CmdOpen,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
+	})
+
+	assert([]string{"lemonade", "version", "--remote"}, CLI{
+		Cmd:               CmdVersion,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		Remote:            true,
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		ClipboardPoll:     2 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
+	})
+
+	assert([]string{"lemonade", "history", "3", "--promote"}, CLI{
+		Cmd:               CmdHistory,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		DataSource:        "3",
+		Promote:           true,
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
+		ClipboardPoll:     2 * time.Second,
+	})
+
+	// deprecated name of --clipboard-poll still works
+	assert([]string{"lemonade", "server", "--history-poll=5s"}, CLI{
+		Cmd:               CmdServer,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
+		ClipboardPoll:     5 * time.Second,
+	})
+
+	assert([]string{"lemonade", "server", "--policy-builtin"}, CLI{
+		Cmd:               CmdServer,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		PolicyBuiltin:     true,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
+		ClipboardPoll:     2 * time.Second,
+	})
+
+	assert([]string{"lemonade", "stat", "--json"}, CLI{
+		Cmd:               CmdStat,
+		Host:              defaultHost,
+		Port:              defaultPort,
+		Allow:             defaultAllow,
+		JSON:              true,
+		TransLoopback:     true,
+		TransLocalfile:    true,
+		TransFileTimeout:  time.Second,
+		TransFilePort:     defaultPort + 1,
+		CompressThreshold: 1024,
+		Compress:          "none",
+		OSC52MaxSize:      74994,
+		SyncDebounce:      500 * time.Millisecond,
+		SyncDirection:     "both",
+		WatchSeparator:    `\n`,
+		Backend:           "atotto",
+		HandshakeTimeout:  10 * time.Second,
+		AllowRefresh:      5 * time.Minute,
+		SocketPerm:        "0600",
+		ClipboardPoll:     2 * time.Second,
 	})
 }
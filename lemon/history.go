@@ -0,0 +1,222 @@
+package lemon
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+// ErrHistoryDisabled is returned by history calls when server does not keep history.
+var ErrHistoryDisabled = errors.New("clipboard history is disabled on server")
+
+const (
+	historyPreview = 60
+	historyLocal   = "local"
+)
+
+type historyEntry struct {
+	time   time.Time
+	source string
+	text   string
+}
+
+// historyRing keeps bounded list of recent clipboard entries, dropping the oldest ones when limits are exceeded.
+type historyRing struct {
+	mu       sync.Mutex
+	entries  []historyEntry // oldest first
+	total    int
+	size     int
+	maxBytes int
+	exclude  RegexpList
+}
+
+func newHistoryRing(size, maxBytes int, exclude RegexpList) *historyRing {
+	if size <= 0 {
+		return nil
+	}
+	return &historyRing{
+		entries:  make([]historyEntry, 0, size),
+		size:     size,
+		maxBytes: maxBytes,
+		exclude:  exclude,
+	}
+}
+
+// add puts text on top of history, returns false if text should not be kept. Text already in history is moved
+// on top rather than duplicated.
+func (h *historyRing) add(text, source string, now time.Time) bool {
+	if len(text) == 0 || (h.maxBytes > 0 && len(text) > h.maxBytes) {
+		return false
+	}
+	for _, re := range h.exclude {
+		if re.MatchString(text) {
+			return false
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if n := len(h.entries); n > 0 && h.entries[n-1].text == text {
+		return false
+	}
+	for i, e := range h.entries {
+		if e.text == text {
+			h.total -= len(e.text)
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			break
+		}
+	}
+	h.entries = append(h.entries, historyEntry{time: now, source: source, text: text})
+	h.total += len(text)
+
+	drop := 0
+	for len(h.entries)-drop > h.size || (h.maxBytes > 0 && h.total > h.maxBytes) {
+		h.total -= len(h.entries[drop].text)
+		drop++
+	}
+	if drop > 0 {
+		h.entries = append(h.entries[:0], h.entries[drop:]...)
+	}
+	return true
+}
+
+func (h *historyRing) get(index int, full bool) (param.HistoryEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if index < 0 || index >= len(h.entries) {
+		return param.HistoryEntry{}, fmt.Errorf("no history entry %d, there are %d entries", index, len(h.entries))
+	}
+	e := h.entries[len(h.entries)-1-index]
+	res := param.HistoryEntry{
+		Index:   index,
+		Time:    e.time,
+		Size:    len(e.text),
+		Source:  e.source,
+		Preview: preview(e.text),
+	}
+	if full {
+		res.Text = e.text
+	}
+	return res, nil
+}
+
+func (h *historyRing) list() []param.HistoryEntry {
+	h.mu.Lock()
+	n := len(h.entries)
+	h.mu.Unlock()
+
+	res := make([]param.HistoryEntry, 0, n)
+	for i := 0; i < n; i++ {
+		e, err := h.get(i, false)
+		if err != nil {
+			// history could only grow shorter when entry is moved on top
+			break
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+// preview makes single line abbreviated version of text suitable for listing.
+func preview(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= historyPreview {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:historyPreview-3]) + "..."
+}
+
+// peerSource describes peer in history entries.
+func peerSource(peer net.Addr) string {
+	switch addr := peer.(type) {
+	case *net.TCPAddr:
+		return addr.IP.String()
+	case *net.UnixAddr:
+		return "unix"
+	default:
+		return peer.String()
+	}
+}
+
+// History is used by "lemonade" to rpc clipboard history.
+type History struct {
+	cli  *CLI
+	svc  *Service
+	peer net.Addr
+}
+
+// NewHistory initializes History structure for connection with peer.
+func NewHistory(s *Service, peer net.Addr) *History {
+	return &History{
+		cli:  s.cli,
+		svc:  s,
+		peer: peer,
+	}
+}
+
+func (h *History) check() error {
+	if err := h.svc.checkRate(h.peer); err != nil {
+		return err
+	}
+	if h.svc.history == nil {
+		return ErrHistoryDisabled
+	}
+	return nil
+}
+
+// List is implementation of "lemonade" rpc "history" command without entry index.
+func (h *History) List(_ struct{}, resp *[]param.HistoryEntry) error {
+	if err := h.check(); err != nil {
+		return err
+	}
+	*resp = h.svc.history.list()
+	if h.cli.Debug {
+		log.Printf("lemonade History.List request from '%s' returned %d entries", h.peer, len(*resp))
+	}
+	return nil
+}
+
+// Get is implementation of "lemonade" rpc "history" command with entry index.
+func (h *History) Get(index int, resp *param.HistoryEntry) error {
+	if err := h.check(); err != nil {
+		return err
+	}
+	e, err := h.svc.history.get(index, true)
+	if h.cli.Debug {
+		log.Printf("lemonade History.Get %d request from '%s' received len: %d, error: '%+v'", index, h.peer, e.Size, err)
+	}
+	*resp = e
+	return err
+}
+
+// Promote is implementation of "lemonade" rpc "history --promote" command: entry becomes current clipboard content.
+func (h *History) Promote(index int, _ *struct{}) error {
+	if err := h.check(); err != nil {
+		return err
+	}
+	e, err := h.svc.history.get(index, true)
+	if err != nil {
+		return err
+	}
+	if h.cli.Debug {
+		log.Printf("lemonade History.Promote %d request from '%s'", index, h.peer)
+	}
+	if _, err := h.svc.call("Promote", h.peer, func() (string, error) {
+		return "", h.svc.backend.WriteAll(e.Text)
+	}); err != nil {
+		return err
+	}
+	h.svc.changed(e.Text, e.Source, "")
+	h.svc.recordStat(newStat(peerSource(h.peer), param.MIMEText, []byte(e.Text)))
+	return nil
+}
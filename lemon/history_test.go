@@ -0,0 +1,145 @@
+package lemon
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+func TestHistoryRing(t *testing.T) {
+	texts := func(h *historyRing) string {
+		var s []string
+		for _, e := range h.list() {
+			s = append(s, e.Preview)
+		}
+		return strings.Join(s, ",")
+	}
+
+	h := newHistoryRing(3, 12, RegexpList{regexp.MustCompile(`^secret`)})
+	now := time.Now()
+	for _, text := range []string{"one", "two", "", "secret one", "three", "three", "four"} {
+		h.add(text, historyLocal, now)
+	}
+	if got := texts(h); got != "four,three,two" {
+		t.Errorf("Expected 'four,three,two', but got '%s'", got)
+	}
+
+	// duplicates are moved on top
+	h.add("two", historyLocal, now)
+	if got := texts(h); got != "two,four,three" {
+		t.Errorf("Expected 'two,four,three', but got '%s'", got)
+	}
+
+	// total size is limited
+	if h.add("0123456789abc", historyLocal, now) {
+		t.Errorf("Expected entry larger than limit to be rejected")
+	}
+	h.add("01234567", historyLocal, now)
+	if got := texts(h); got != "01234567,two" {
+		t.Errorf("Expected '01234567,two', but got '%s'", got)
+	}
+
+	if _, err := h.get(2, true); err == nil {
+		t.Errorf("Expected error for missing entry")
+	}
+	if newHistoryRing(0, 0, nil) != nil {
+		t.Errorf("Expected history to be disabled")
+	}
+}
+
+func TestHistoryPreview(t *testing.T) {
+	if got := preview("  line one\n\tline two  "); got != "line one line two" {
+		t.Errorf("Unexpected preview: '%s'", got)
+	}
+	if got := preview(strings.Repeat("я", 100)); got != strings.Repeat("я", historyPreview-3)+"..." {
+		t.Errorf("Unexpected preview: '%s'", got)
+	}
+}
+
+func TestServiceHistory(t *testing.T) {
+
+	m := newMemClipboard()
+	c := New()
+	c.HistorySize = 10
+	svc := NewService(c, m)
+
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	for _, text := range []string{"first", "second"} {
+		if err := rc.Call("Clipboard.Copy", text, dummy); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var entries []param.HistoryEntry
+	if err := rc.Call("History.List", dummy, &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Preview != "second" || entries[0].Source != "192.168.0.1" || len(entries[0].Text) != 0 {
+		t.Fatalf("Unexpected history: %+v", entries)
+	}
+
+	var e param.HistoryEntry
+	if err := rc.Call("History.Get", 1, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Text != "first" || e.Size != 5 {
+		t.Errorf("Unexpected entry: %+v", e)
+	}
+
+	if err := rc.Call("History.Promote", 1, dummy); err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := m.ReadAll(); text != "first" {
+		t.Errorf("Expected promoted entry in clipboard, but got '%s'", text)
+	}
+	if err := rc.Call("History.List", dummy, &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Preview != "first" {
+		t.Errorf("Expected promoted entry on top: %+v", entries)
+	}
+
+	if err := rc.Call("History.Get", 5, &e); err == nil {
+		t.Errorf("Expected error for missing entry")
+	}
+
+	// local changes are observed
+	c.ClipboardPoll = time.Millisecond
+	svc.StartMonitor()
+	defer svc.Close()
+	if err := m.WriteAll("local"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if err := rc.Call("History.List", dummy, &entries); err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(entries) != 3 || entries[0].Preview != "local" || entries[0].Source != historyLocal {
+		t.Errorf("Expected local change in history: %+v", entries)
+	}
+}
+
+func TestServiceHistoryDisabled(t *testing.T) {
+
+	m := newMemClipboard()
+	rc := dialService(t, NewService(New(), m), &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	var entries []param.HistoryEntry
+	err := rc.Call("History.List", dummy, &entries)
+	if err == nil || err.Error() != ErrHistoryDisabled.Error() {
+		t.Errorf("Expected '%v', but got '%v'", ErrHistoryDisabled, err)
+	}
+}
@@ -0,0 +1,78 @@
+package lemon
+
+import (
+	"log"
+	"net/rpc"
+	"runtime"
+
+	"github.com/rupor-github/lemonade/misc"
+	"github.com/rupor-github/lemonade/param"
+)
+
+// Info is used by "lemonade" to rpc server information.
+type Info struct {
+	cli *CLI
+	svc *Service
+}
+
+// NewInfo initializes Info structure.
+func NewInfo(s *Service) *Info {
+	return &Info{
+		cli: s.cli,
+		svc: s,
+	}
+}
+
+func (i *Info) capabilities() []string {
+	caps := []string{param.CapWatch, param.CapChunked, param.CapCompress, param.CapStat}
+	if _, ok := i.svc.backend.(TypedBackend); ok {
+		caps = append(caps, param.CapTyped)
+	}
+	if _, ok := i.svc.backend.(SelectionBackend); ok {
+		caps = append(caps, param.CapSelection)
+	}
+	if i.cli.JSONRPC || i.cli.JSONRPCPort != 0 {
+		caps = append(caps, param.CapJSONRPC)
+	}
+	if i.cli.HTTPPort != 0 {
+		caps = append(caps, param.CapHTTP)
+	}
+	if i.cli.HistorySize > 0 {
+		caps = append(caps, param.CapHistory)
+	}
+	return caps
+}
+
+// Info is implementation of "lemonade" rpc "Server.Info" command.
+func (i *Info) Info(_ struct{}, resp *param.InfoResult) error {
+	*resp = param.InfoResult{
+		Version:         misc.GetVersion(),
+		OS:              runtime.GOOS,
+		Arch:            runtime.GOARCH,
+		ProtocolVersion: param.ProtocolVersion,
+		Capabilities:    i.capabilities(),
+		LineEnding:      i.cli.LineEnding,
+		MaxPayload:      i.cli.MaxCopySize,
+	}
+	if i.cli.Debug {
+		log.Printf("lemonade Info request: '%+v'", *resp)
+	}
+	return nil
+}
+
+// ServerInfo asks server about itself once. Servers which do not support "Server.Info" are reported as protocol
+// version 0 without any capabilities, so client could degrade gracefully.
+func (c *CLI) ServerInfo(rc *rpc.Client) *param.InfoResult {
+	if c.info != nil {
+		return c.info
+	}
+	info := &param.InfoResult{}
+	if err := rc.Call("Server.Info", struct{}{}, info); err != nil {
+		if c.Debug {
+			log.Printf("Client Server.Info received error, assuming legacy server: '%s'", err.Error())
+		}
+		info = &param.InfoResult{}
+	}
+	c.info = info
+	return info
+}
@@ -2,60 +2,270 @@ package lemon
 
 // This comes directly from https://github.com/pocke/go-iprange
 // I simply could not stand using "InlucdeConn"..., literately
+//
+// Since then it was extended: rules are evaluated in order and the first matching one wins, rule prefixed with "!"
+// denies access, named groups and host names could be used in addition to IPs and CIDRs. Host names are resolved
+// again periodically. IPv6 rule may specify zone ("fe80::/10%eth0") in which case only peers from that zone match.
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
-// Range defines slice of checkable addresses.
-type Range struct {
-	allows []*net.IPNet
+// Replaceable for testing.
+var lookupIP = net.LookupIP
+
+var groups = map[string][]string{
+	"any":        {"0.0.0.0/0", "::/0"},
+	"loopback":   {"127.0.0.0/8", "::1/128"},
+	"private":    {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"},
+	"link-local": {"169.254.0.0/16", "fe80::/10"},
 }
 
-// NewRange parses comma delimited list of addresses and allocates new range.
-func NewRange(ipStr string) (*Range, error) {
+var hostRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*\.?$`)
 
-	IPs := strings.Split(ipStr, ",")
-	r := &Range{
-		allows: make([]*net.IPNet, 0, len(IPs)),
+type rule struct {
+	spec string // as specified, for diagnostics
+	deny bool
+	zone string
+	host string // non empty if addresses come from resolving host name
+	nets []*net.IPNet
+}
+
+func (r *rule) match(addr net.IP, zone string) bool {
+	if len(r.zone) > 0 && r.zone != zone {
+		return false
+	}
+	for _, n := range r.nets {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveHost looks host name up, it may block for a while.
+func resolveHost(host string) ([]*net.IPNet, error) {
+	ips, err := lookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("no addresses")
+	}
+	nets := make([]*net.IPNet, 0, len(ips))
+	for _, ip := range ips {
+		nets = append(nets, hostNet(ip))
+	}
+	return nets, nil
+}
+
+func hostNet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
 	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+func parseRule(spec string) (*rule, error) {
+
+	r := &rule{spec: spec}
 
-	for _, i := range IPs {
-		if !strings.Contains(i, "/") {
-			if strings.Contains(i, ".") { // IPv4
-				i += "/32"
-			} else { // IPv6
-				i += "/128"
-			}
+	s := spec
+	if strings.HasPrefix(s, "!") {
+		r.deny = true
+		s = s[1:]
+	}
+	if len(s) == 0 {
+		return nil, errors.New("empty rule")
+	}
+
+	// zone could be specified either after address or after prefix length
+	if i := strings.Index(s, "%"); i >= 0 {
+		j := strings.Index(s[i:], "/")
+		if j < 0 {
+			r.zone, s = s[i+1:], s[:i]
+		} else {
+			r.zone, s = s[i+1:i+j], s[:i]+s[i+j:]
+		}
+		if len(r.zone) == 0 {
+			return nil, errors.New("empty IPv6 zone")
+		}
+	}
+
+	if cidrs, ok := groups[strings.ToLower(s)]; ok {
+		for _, c := range cidrs {
+			_, n, _ := net.ParseCIDR(c)
+			r.nets = append(r.nets, n)
 		}
+		return r, nil
+	}
 
-		_, mask, err := net.ParseCIDR(i)
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
 		if err != nil {
 			return nil, err
 		}
-		r.allows = append(r.allows, mask)
+		if len(r.zone) > 0 && n.IP.To4() != nil {
+			return nil, errors.New("zone could only be used with IPv6 addresses")
+		}
+		r.nets = append(r.nets, n)
+		return r, nil
 	}
+
+	if ip := net.ParseIP(s); ip != nil {
+		if len(r.zone) > 0 && ip.To4() != nil {
+			return nil, errors.New("zone could only be used with IPv6 addresses")
+		}
+		r.nets = append(r.nets, hostNet(ip))
+		return r, nil
+	}
+
+	if !hostRe.MatchString(s) {
+		return nil, errors.New("not an IP address, CIDR, group name or host name")
+	}
+	r.host = s
+	nets, err := resolveHost(s)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve host name: %w", err)
+	}
+	r.nets = nets
 	return r, nil
 }
 
-// IsStrIn checks is address (as a string) is included.
+// Range defines ordered list of rules to check addresses against.
+type Range struct {
+	mu    sync.Mutex // guards addresses of host name rules
+	rules []*rule
+	stop  chan struct{}
+	done  chan struct{} // closed when background resolution is over
+	once  sync.Once
+}
+
+// NewRange parses comma delimited list of rules and allocates new range. Host names are resolved again in
+// background every refresh interval (never if it is 0), Close stops that.
+func NewRange(spec string, refresh time.Duration) (*Range, error) {
+
+	specs := strings.Split(spec, ",")
+	r := &Range{
+		rules: make([]*rule, 0, len(specs)),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	allows, hosts := 0, 0
+	for i, s := range specs {
+		rl, err := parseRule(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("rule #%d '%s': %w", i+1, s, err)
+		}
+		if !rl.deny {
+			allows++
+		}
+		if len(rl.host) > 0 {
+			hosts++
+		}
+		r.rules = append(r.rules, rl)
+	}
+	if allows == 0 {
+		return nil, fmt.Errorf("no allow rules in '%s', all connections would be rejected", spec)
+	}
+	if refresh > 0 && hosts > 0 {
+		go r.refresh(refresh)
+	} else {
+		close(r.done)
+	}
+	return r, nil
+}
+
+// Close stops resolving host names waiting for lookup in progress, it is safe to call it more than once.
+func (r *Range) Close() {
+	r.once.Do(func() { close(r.stop) })
+	<-r.done
+}
+
+func (r *Range) refresh(interval time.Duration) {
+	defer close(r.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.resolve()
+		}
+	}
+}
+
+// resolve refreshes host name rules, keeping old addresses on failures. Lookups are done without holding the lock,
+// so connections are never kept waiting for DNS.
+func (r *Range) resolve() {
+	for _, rl := range r.rules {
+		if len(rl.host) == 0 {
+			continue
+		}
+		nets, err := resolveHost(rl.host)
+		if err != nil {
+			log.Printf("Unable to resolve '%s' from allowed range, keeping previous addresses: %s", rl.host, err.Error())
+			continue
+		}
+		r.mu.Lock()
+		rl.nets = nets
+		r.mu.Unlock()
+	}
+}
+
+// Match returns verdict for address and rule which decided it (empty if none matched).
+func (r *Range) Match(addr net.IP, zone string) (bool, string) {
+	if addr == nil {
+		return false, ""
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rl := range r.rules {
+		if rl.match(addr, zone) {
+			return !rl.deny, rl.spec
+		}
+	}
+	return false, ""
+}
+
+// IsStrIn checks is address (as a string, possibly with IPv6 zone) is included.
 func (r *Range) IsStrIn(addr string) bool {
-	return r.IsIn(net.ParseIP(addr))
+	var zone string
+	if i := strings.LastIndex(addr, "%"); i >= 0 {
+		addr, zone = addr[:i], addr[i+1:]
+	}
+	ok, _ := r.Match(net.ParseIP(addr), zone)
+	return ok
 }
 
 // IsIn checks is address is included.
 func (r *Range) IsIn(addr net.IP) bool {
-	for _, m := range r.allows {
-		if m.Contains(addr) {
-			return true
-		}
-	}
-	return false
+	ok, _ := r.Match(addr, "")
+	return ok
 }
 
 // IsConnIn checks is connection's remote address is included.
+// Unix domain socket peers are always allowed - access to them is controlled by socket file permissions,
+// any other non TCP peers are rejected.
 func (r *Range) IsConnIn(conn net.Conn) bool {
-	addr, _ := conn.RemoteAddr().(*net.TCPAddr)
-	return r.IsIn(addr.IP)
+	switch addr := conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		ok, _ := r.Match(addr.IP, addr.Zone)
+		return ok
+	case *net.UnixAddr:
+		return true
+	default:
+		return false
+	}
 }
@@ -0,0 +1,207 @@
+package lemon
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRangeIsStrIn(t *testing.T) {
+	assert := func(spec, addr string, expected bool) {
+		t.Helper()
+		r, err := NewRange(spec, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.IsStrIn(addr); got != expected {
+			t.Errorf("'%s' in '%s' - expected: %v, but got %v", addr, spec, expected, got)
+		}
+	}
+
+	assert("0.0.0.0/0,::/0", "192.168.0.1", true)
+	assert("0.0.0.0/0,::/0", "::1", true)
+	assert("192.168.0.0/24", "192.168.0.1", true)
+	assert("192.168.0.0/24", "192.168.1.1", false)
+	assert("192.168.0.1", "192.168.0.1", true)
+	assert("192.168.0.1", "192.168.0.2", false)
+	assert("::1", "::1", true)
+	assert("::1", "::2", false)
+	assert("192.168.0.0/24", "::ffff:192.168.0.1", true)
+	assert("192.168.0.0/24", "garbage", false)
+
+	// rules are evaluated in order, first match wins
+	assert("!10.0.5.0/24,10.0.0.0/8", "10.0.5.1", false)
+	assert("!10.0.5.0/24,10.0.0.0/8", "10.0.6.1", true)
+	assert("10.0.0.0/8,!10.0.5.0/24", "10.0.5.1", true)
+	assert("!10.0.5.0/24, 10.0.0.0/8", "10.0.6.1", true)
+
+	// groups
+	assert("loopback", "127.0.0.1", true)
+	assert("loopback", "::1", true)
+	assert("loopback", "192.168.0.1", false)
+	assert("private", "172.16.1.1", true)
+	assert("private", "fd00::1", true)
+	assert("private", "8.8.8.8", false)
+	assert("link-local", "169.254.1.1", true)
+	assert("link-local", "fe80::1", true)
+	assert("!private,any", "8.8.8.8", true)
+	assert("!private,any", "10.1.1.1", false)
+	assert("Loopback", "127.0.0.1", true)
+
+	// zones
+	assert("fe80::/10%eth0", "fe80::1%eth0", true)
+	assert("fe80::/10%eth0", "fe80::1%eth1", false)
+	assert("fe80::/10%eth0", "fe80::1", false)
+	assert("fe80::%eth0/10", "fe80::1%eth0", true)
+	assert("fe80::1%eth0", "fe80::1%eth0", true)
+	assert("fe80::/10", "fe80::1%eth1", true)
+}
+
+func TestRangeErrors(t *testing.T) {
+	assert := func(spec, expected string) {
+		t.Helper()
+		_, err := NewRange(spec, 0)
+		if err == nil {
+			t.Errorf("Expected error for '%s'", spec)
+			return
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error for '%s' to contain '%s', but got '%s'", spec, expected, err.Error())
+		}
+	}
+
+	assert("", "rule #1")
+	assert("10.0.0.0/8,", "rule #2")
+	assert("10.0.0.0/33", "rule #1")
+	assert("!", "empty rule")
+	assert("10.0.0.0/8%eth0", "zone")
+	assert("fe80::/10%", "empty IPv6 zone")
+	assert("bad_host!", "not an IP address")
+	assert("!10.0.0.0/8,!loopback", "no allow rules")
+}
+
+func TestRangeHostNames(t *testing.T) {
+
+	saved := lookupIP
+	defer func() { lookupIP = saved }()
+
+	var (
+		mu      sync.Mutex
+		lookups int
+		block   chan struct{} // lookups wait for it to be closed when set
+	)
+	addrs := map[string][]net.IP{
+		"dev.example.com": {net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1")},
+	}
+	lookupIP = func(host string) ([]net.IP, error) {
+		mu.Lock()
+		lookups++
+		wait := block
+		mu.Unlock()
+		if wait != nil {
+			<-wait
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if ips, ok := addrs[host]; ok {
+			return ips, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	set := func(f func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		f()
+	}
+	resolved := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return lookups
+	}
+	eventually := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if _, err := NewRange("unknown.example.com", 0); err == nil || !strings.Contains(err.Error(), "unable to resolve") {
+		t.Errorf("Expected resolution error, but got '%v'", err)
+	}
+
+	r, err := NewRange("dev.example.com", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if !r.IsStrIn("10.0.0.1") || !r.IsStrIn("fd00::1") || r.IsStrIn("10.0.0.2") {
+		t.Errorf("Unexpected results for resolved host")
+	}
+
+	// addresses are updated when host is resolved again in background
+	set(func() { addrs["dev.example.com"] = []net.IP{net.ParseIP("10.0.0.2")} })
+	eventually("host name to be resolved again", func() bool { return !r.IsStrIn("10.0.0.1") && r.IsStrIn("10.0.0.2") })
+
+	// and kept when resolution fails
+	set(func() { delete(addrs, "dev.example.com") })
+	n := resolved()
+	eventually("failed resolution", func() bool { return resolved() > n+1 })
+	if !r.IsStrIn("10.0.0.2") {
+		t.Errorf("Expected previous addresses to be kept")
+	}
+
+	// slow DNS does not hold connections
+	wait := make(chan struct{})
+	set(func() { block = wait })
+	n = resolved()
+	eventually("blocked resolution", func() bool { return resolved() > n })
+	done := make(chan bool)
+	go func() { done <- r.IsStrIn("10.0.0.2") }()
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Errorf("Expected previous addresses to be used while host name is being resolved")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected address to be checked while host name is being resolved")
+	}
+	set(func() { block = nil })
+	close(wait)
+
+	// nothing is resolved after range is closed
+	r.Close()
+	n = resolved()
+	time.Sleep(10 * time.Millisecond)
+	if resolved() != n {
+		t.Errorf("Expected host names not to be resolved after range is closed")
+	}
+}
+
+func TestRangeIsConnIn(t *testing.T) {
+	r, err := NewRange("!10.0.5.0/24,private", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.IsConnIn(&ConnMock{addr: &net.TCPAddr{IP: net.ParseIP("10.0.6.1")}}) {
+		t.Errorf("Expected connection to be allowed")
+	}
+	if r.IsConnIn(&ConnMock{addr: &net.TCPAddr{IP: net.ParseIP("10.0.5.1")}}) {
+		t.Errorf("Expected connection to be denied")
+	}
+	// access to unix domain sockets is controlled by file permissions, whatever peer name is
+	for _, name := range []string{"", "@", "/tmp/lemonade.sock"} {
+		if !r.IsConnIn(&ConnMock{addr: &net.UnixAddr{Name: name, Net: "unix"}}) {
+			t.Errorf("Expected unix socket connection from '%s' to be allowed", name)
+		}
+	}
+	if r.IsConnIn(&ConnMock{addr: &net.UDPAddr{IP: net.ParseIP("10.0.6.1")}}) {
+		t.Errorf("Expected connection over other network to be denied")
+	}
+}
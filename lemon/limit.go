@@ -0,0 +1,105 @@
+package lemon
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// Errors returned to clients when request is rejected, rpc transfers only error text.
+var (
+	ErrTooLarge    = errors.New("payload too large")
+	ErrRateLimited = errors.New("rate limit exceeded")
+)
+
+const maxBuckets = 1024
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is token bucket rate limiter keyed by remote IP.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(burst)
+	if b <= 0 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   b,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (rl *rateLimiter) allow(key string, now time.Time) bool {
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		if len(rl.buckets) >= maxBuckets {
+			rl.cleanup(now)
+		}
+		b = &bucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// cleanup drops buckets which are full again - they are no different from new ones.
+func (rl *rateLimiter) cleanup(now time.Time) {
+	for k, b := range rl.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rl.rate >= rl.burst {
+			delete(rl.buckets, k)
+		}
+	}
+}
+
+func peerKey(peer net.Addr) string {
+	if addr, ok := peer.(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return peer.String()
+}
+
+// checkRate rejects calls from peer exceeding configured rate.
+func (s *Service) checkRate(peer net.Addr) error {
+	if s.limiter == nil || s.limiter.allow(peerKey(peer), time.Now()) {
+		return nil
+	}
+	if s.cli.Debug {
+		log.Printf("lemonade rate limit exceeded by '%s'", peer)
+	}
+	return fmt.Errorf("%w: no more than %g calls per second allowed", ErrRateLimited, s.limiter.rate)
+}
+
+// checkSize rejects payloads exceeding limit (if set).
+func checkSize(what string, size, limit int) error {
+	if limit > 0 && size > limit {
+		return fmt.Errorf("%w: %s is %d bytes, limit is %d bytes", ErrTooLarge, what, size, limit)
+	}
+	return nil
+}
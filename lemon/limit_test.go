@@ -0,0 +1,154 @@
+package lemon
+
+import (
+	"encoding/gob"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+func TestRateLimiter(t *testing.T) {
+
+	rl := newRateLimiter(2, 3)
+	now := time.Now()
+
+	// burst is allowed immediately
+	for i := 0; i < 3; i++ {
+		if !rl.allow("10.0.0.1", now) {
+			t.Fatalf("Expected call %d to be allowed", i)
+		}
+	}
+	if rl.allow("10.0.0.1", now) {
+		t.Errorf("Expected call above burst to be rejected")
+	}
+	// other peers have their own buckets
+	if !rl.allow("10.0.0.2", now) {
+		t.Errorf("Expected call from another peer to be allowed")
+	}
+	// tokens are replenished with time
+	now = now.Add(500 * time.Millisecond)
+	if !rl.allow("10.0.0.1", now) {
+		t.Errorf("Expected call to be allowed after token is replenished")
+	}
+	if rl.allow("10.0.0.1", now) {
+		t.Errorf("Expected call to be rejected before token is replenished")
+	}
+
+	if newRateLimiter(0, 10) != nil {
+		t.Errorf("Expected no rate limiter when rate is not set")
+	}
+}
+
+func TestServiceLimits(t *testing.T) {
+
+	m := newMemClipboard()
+
+	c := New()
+	c.MaxCopySize = 4
+	c.RateLimit = 1
+	c.RateBurst = 2
+	svc := NewService(c, m)
+
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	if err := rc.Call("Clipboard.Copy", "12345", dummy); err == nil || !strings.HasPrefix(err.Error(), ErrTooLarge.Error()) {
+		t.Errorf("Expected '%s' error, but got '%v'", ErrTooLarge, err)
+	}
+	if err := rc.Call("Clipboard.Copy", "1234", dummy); err != nil {
+		t.Errorf("Expected success, but got '%v'", err)
+	}
+	if err := rc.Call("Clipboard.Copy", "1234", dummy); err == nil || !strings.HasPrefix(err.Error(), ErrRateLimited.Error()) {
+		t.Errorf("Expected '%s' error, but got '%v'", ErrRateLimited, err)
+	}
+	if info := c.ServerInfo(rc); info.MaxPayload != c.MaxCopySize {
+		t.Errorf("Expected max payload %d, but got %d", c.MaxCopySize, info.MaxPayload)
+	}
+}
+
+func TestTransportLimits(t *testing.T) {
+
+	m := newMemClipboard()
+	c := New()
+	c.MaxCopySize = 1024
+	c.MaxURISize = 64
+	svc := NewService(c, m)
+	peer := &net.TCPAddr{IP: net.ParseIP("192.168.0.1")}
+
+	// request declaring huge message is rejected as soon as its length is read, server never waits for the rest
+	sc, cc := net.Pipe()
+	defer cc.Close()
+	go func() { _ = svc.ServeConn(&peerConn{Conn: sc, peer: peer}, CodecGob) }()
+	go func() {
+		_ = gob.NewEncoder(cc).Encode(&rpc.Request{ServiceMethod: "Clipboard.Copy", Seq: 1})
+		_, _ = cc.Write([]byte{0xFC, 0x20, 0x00, 0x00, 0x00}) // 512MB
+	}()
+	done := make(chan rpc.Response, 1)
+	go func() {
+		var resp rpc.Response
+		_ = gob.NewDecoder(cc).Decode(&resp)
+		done <- resp
+	}()
+	select {
+	case resp := <-done:
+		if !strings.HasPrefix(resp.Error, ErrTooLarge.Error()) {
+			t.Errorf("Expected '%s' error, but got '%s'", ErrTooLarge, resp.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected oversized request to be rejected without reading it")
+	}
+
+	// connection is closed after oversized request, stream could not be trusted anymore
+	rc := dialService(t, svc, peer)
+	if err := rc.Call("Clipboard.Copy", strings.Repeat("x", 1<<20), dummy); err == nil || !strings.HasPrefix(err.Error(), ErrTooLarge.Error()) {
+		t.Errorf("Expected '%s' error, but got '%v'", ErrTooLarge, err)
+	}
+	if err := rc.Call("Clipboard.Copy", "text", dummy); err == nil {
+		t.Errorf("Expected connection to be closed after oversized request")
+	}
+	rc.Close()
+
+	rc = dialService(t, svc, peer)
+	if err := rc.Call("URI.Open", &param.OpenParam{URI: "http://" + strings.Repeat("x", 8192)}, dummy); err == nil || !strings.HasPrefix(err.Error(), ErrTooLarge.Error()) {
+		t.Errorf("Expected '%s' error, but got '%v'", ErrTooLarge, err)
+	}
+	rc.Close()
+
+	// content within limit still goes through
+	rc = dialService(t, svc, peer)
+	if err := rc.Call("Clipboard.Copy", strings.Repeat("y", 1024), dummy); err != nil {
+		t.Errorf("Expected success, but got '%v'", err)
+	}
+	rc.Close()
+
+	sc, cc = net.Pipe()
+	go func() { _ = svc.ServeConn(&peerConn{Conn: sc, peer: peer}, CodecJSON) }()
+	jc := jsonrpc.NewClient(cc)
+	defer jc.Close()
+	if err := jc.Call("Clipboard.Copy", strings.Repeat("z", 1<<20), dummy); err == nil {
+		t.Errorf("Expected oversized JSON-RPC request to fail")
+	}
+	if text, _ := m.ReadAll(); text != strings.Repeat("y", 1024) {
+		t.Errorf("Expected clipboard to be unchanged, but got %d bytes", len(text))
+	}
+
+	// URI size limit alone bounds JSON-RPC requests too, connection is closed when it is exceeded
+	c = New()
+	c.MaxURISize = 64
+	svc = NewService(c, m)
+	sc, cc = net.Pipe()
+	go func() { _ = svc.ServeConn(&peerConn{Conn: sc, peer: peer}, CodecJSON) }()
+	jc = jsonrpc.NewClient(cc)
+	defer jc.Close()
+	if err := jc.Call("URI.Open", &param.OpenParam{URI: "http://" + strings.Repeat("x", 8<<20)}, dummy); err == nil {
+		t.Errorf("Expected oversized JSON-RPC request to fail")
+	}
+	if err := jc.Call("Clipboard.Copy", "text", dummy); err == nil {
+		t.Errorf("Expected connection to be closed after oversized JSON-RPC request")
+	}
+}
@@ -0,0 +1,80 @@
+package lemon
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+// Terminals and multiplexers are known to limit size of OSC 52 sequence to 100000 bytes, which is about that much
+// text after base64 encoding.
+const osc52MaxSize = 74994
+
+// screen does not pass DCS strings longer than that.
+const screenChunk = 76
+
+// Multiplexers OSC 52 sequence should be wrapped for.
+const (
+	muxNone = iota
+	muxTmux
+	muxScreen
+)
+
+func detectMux() int {
+	switch {
+	case len(os.Getenv("TMUX")) > 0:
+		return muxTmux
+	case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+		return muxScreen
+	default:
+		return muxNone
+	}
+}
+
+func osc52Target(sel string) string {
+	switch strings.ToLower(sel) {
+	case param.SelectionPrimary:
+		return "p"
+	case param.SelectionBoth:
+		return "pc"
+	default:
+		return "c"
+	}
+}
+
+// OSC52 prepares terminal escape sequence which sets clipboard (selection) to text, wrapping it for terminal
+// multiplexer if necessary.
+func OSC52(text, sel string, maxSize int) (string, error) {
+	if maxSize > 0 && len(text) > maxSize {
+		return "", fmt.Errorf("%w: text is %d bytes, OSC 52 limit is %d bytes", ErrTooLarge, len(text), maxSize)
+	}
+	if err := CheckSelection(sel); err != nil {
+		return "", err
+	}
+	seq := "\x1b]52;" + osc52Target(sel) + ";" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	return wrapOSC52(seq, detectMux()), nil
+}
+
+func wrapOSC52(seq string, mux int) string {
+	switch mux {
+	case muxTmux:
+		// passthrough requires escapes to be doubled
+		return "\x1bPtmux;" + strings.Replace(seq, "\x1b", "\x1b\x1b", -1) + "\x1b\\"
+	case muxScreen:
+		var buf strings.Builder
+		for len(seq) > 0 {
+			n := screenChunk
+			if n > len(seq) {
+				n = len(seq)
+			}
+			buf.WriteString("\x1bP" + seq[:n] + "\x1b\\")
+			seq = seq[n:]
+		}
+		return buf.String()
+	default:
+		return seq
+	}
+}
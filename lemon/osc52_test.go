@@ -0,0 +1,65 @@
+package lemon
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOSC52(t *testing.T) {
+
+	for _, name := range []string{"TMUX", "TERM"} {
+		if v, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, v)
+		}
+		os.Unsetenv(name)
+	}
+
+	assert := func(text, sel, expected string) {
+		t.Helper()
+		got, err := OSC52(text, sel, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected {
+			t.Errorf("Expected %q, but got %q", expected, got)
+		}
+	}
+	assert("hello", "", "\x1b]52;c;aGVsbG8=\a")
+	assert("hello", "primary", "\x1b]52;p;aGVsbG8=\a")
+	assert("hello", "both", "\x1b]52;pc;aGVsbG8=\a")
+
+	if _, err := OSC52("01234567890", "", 10); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected '%v', but got '%v'", ErrTooLarge, err)
+	}
+	if _, err := OSC52("01234567890", "", 0); err != nil {
+		t.Errorf("Expected no limit, but got '%v'", err)
+	}
+	if _, err := OSC52("text", "secondary", 0); err == nil {
+		t.Errorf("Expected error for unknown selection")
+	}
+
+	os.Setenv("TMUX", "/tmp/tmux-1000/default,1,0")
+	defer os.Unsetenv("TMUX")
+	assert("hello", "", "\x1bPtmux;\x1b\x1b]52;c;aGVsbG8=\a\x1b\\")
+}
+
+func TestWrapOSC52Screen(t *testing.T) {
+	seq := "\x1b]52;c;" + strings.Repeat("A", 100) + "\a"
+	got := wrapOSC52(seq, muxScreen)
+	chunks := strings.Split(strings.TrimSuffix(got, "\x1b\\"), "\x1b\\")
+	if len(chunks) != 2 {
+		t.Fatalf("Expected 2 chunks, but got %d: %q", len(chunks), got)
+	}
+	var joined string
+	for _, c := range chunks {
+		if !strings.HasPrefix(c, "\x1bP") || len(c) > screenChunk+2 {
+			t.Errorf("Bad chunk %q", c)
+		}
+		joined += strings.TrimPrefix(c, "\x1bP")
+	}
+	if joined != seq {
+		t.Errorf("Expected %q, but got %q", seq, joined)
+	}
+}
@@ -0,0 +1,315 @@
+package lemon
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+// Policy rule actions.
+const (
+	PolicyReject    = "reject"    // refuse to copy or paste content
+	PolicyRedact    = "redact"    // replace matching parts of content
+	PolicySensitive = "sensitive" // never keep content in history, clear it from clipboard after a while
+)
+
+// ErrPolicy is returned to clients when content is rejected by policy, rpc transfers only error text.
+var ErrPolicy = errors.New("rejected by policy")
+
+const defaultEntropyMinLength = 20
+
+// sensitive content is cleared from clipboard after that long unless policy says otherwise
+const defaultClearAfter = 30 * time.Second
+
+// characters of tokens checked by entropy rules without pattern
+const tokenChars = `[A-Za-z0-9+/=_.\-]`
+
+// built-in rules could be changed or disabled in policy file by name
+var builtinRules = []ruleConfig{
+	{Name: "private-key", Pattern: `-----BEGIN[ A-Z0-9]*PRIVATE KEY( BLOCK)?-----(?s:.*?)(-----END[ A-Z0-9]*PRIVATE KEY( BLOCK)?-----|$)`},
+	{Name: "aws-access-key", Pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{Name: "aws-secret-key", Pattern: `(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}\b`},
+	{Name: "github-token", Pattern: `\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`},
+	{Name: "slack-token", Pattern: `\bxox[abposr]-[A-Za-z0-9-]{10,}`},
+	{Name: "google-api-key", Pattern: `\bAIza[0-9A-Za-z_\-]{35}\b`},
+	{Name: "stripe-key", Pattern: `\b[rs]k_live_[0-9A-Za-z]{24,}\b`},
+	{Name: "jwt", Pattern: `\beyJ[A-Za-z0-9_\-]{5,}\.eyJ[A-Za-z0-9_\-]{5,}\.[A-Za-z0-9_\-]*`},
+}
+
+// policyConfig is policy file layout.
+type policyConfig struct {
+	Builtin    *bool        `toml:"builtin"`     // use built-in rules, default true
+	ClearAfter string       `toml:"clear_after"` // how long sensitive content stays in clipboard, default 30s, 0 - forever
+	Rules      []ruleConfig `toml:"rule"`
+}
+
+type ruleConfig struct {
+	Name      string  `toml:"name"`
+	Pattern   string  `toml:"pattern"`
+	Entropy   float64 `toml:"entropy"`    // minimum Shannon entropy of match in bits per character
+	MinLength int     `toml:"min_length"` // minimum length of token checked for entropy when there is no pattern
+	Action    string  `toml:"action"`     // reject, redact or sensitive (default)
+	Disabled  bool    `toml:"disabled"`
+}
+
+type policyRule struct {
+	name    string
+	re      *regexp.Regexp
+	entropy float64
+	action  string
+}
+
+// Policy decides what happens to clipboard text matching configured rules. Rules are evaluated in order: built-in
+// ones first, then ones from policy file.
+type Policy struct {
+	rules      []*policyRule
+	clearAfter time.Duration
+}
+
+// verdict is result of checking text against policy.
+type verdict struct {
+	text      string   // possibly redacted
+	fired     []string // names of matching rules
+	rejected  string   // name of rejecting rule
+	sensitive bool
+}
+
+// LoadPolicy reads policy from toml file.
+func LoadPolicy(path string) (*Policy, error) {
+	var cfg policyConfig
+	if _, err := toml.DecodeFile(path, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to read policy file: %w", err)
+	}
+	return newPolicy(&cfg)
+}
+
+// ParsePolicy reads policy from toml text.
+func ParsePolicy(data string) (*Policy, error) {
+	var cfg policyConfig
+	if _, err := toml.Decode(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse policy: %w", err)
+	}
+	return newPolicy(&cfg)
+}
+
+func newPolicy(cfg *policyConfig) (*Policy, error) {
+
+	p := &Policy{clearAfter: defaultClearAfter}
+	if len(cfg.ClearAfter) > 0 {
+		var err error
+		if p.clearAfter, err = time.ParseDuration(cfg.ClearAfter); err != nil {
+			return nil, fmt.Errorf("bad clear_after value: %w", err)
+		}
+	}
+
+	var configs []ruleConfig
+	if cfg.Builtin == nil || *cfg.Builtin {
+		configs = append(configs, builtinRules...)
+	}
+	for i, rc := range cfg.Rules {
+		if len(rc.Name) == 0 {
+			return nil, fmt.Errorf("policy rule #%d has no name", i+1)
+		}
+		j := 0
+		for ; j < len(configs); j++ {
+			if configs[j].Name == rc.Name {
+				break
+			}
+		}
+		if j == len(configs) {
+			configs = append(configs, rc)
+			continue
+		}
+		// same name changes previous rule keeping what is not set
+		if len(rc.Pattern) == 0 && rc.Entropy == 0 {
+			rc.Pattern, rc.Entropy, rc.MinLength = configs[j].Pattern, configs[j].Entropy, configs[j].MinLength
+		}
+		configs[j] = rc
+	}
+
+	for _, rc := range configs {
+		if rc.Disabled {
+			continue
+		}
+		r, err := newPolicyRule(rc)
+		if err != nil {
+			return nil, fmt.Errorf("policy rule '%s': %w", rc.Name, err)
+		}
+		p.rules = append(p.rules, r)
+	}
+	return p, nil
+}
+
+func newPolicyRule(rc ruleConfig) (*policyRule, error) {
+
+	r := &policyRule{name: rc.Name, entropy: rc.Entropy, action: strings.ToLower(rc.Action)}
+	switch r.action {
+	case "":
+		r.action = PolicySensitive
+	case PolicyReject, PolicyRedact, PolicySensitive:
+	default:
+		return nil, fmt.Errorf("unknown action '%s', should be one of %s, %s or %s", rc.Action, PolicyReject, PolicyRedact, PolicySensitive)
+	}
+	if r.entropy < 0 {
+		return nil, fmt.Errorf("bad entropy %g", r.entropy)
+	}
+
+	switch {
+	case len(rc.Pattern) > 0:
+		var err error
+		if r.re, err = regexp.Compile(rc.Pattern); err != nil {
+			return nil, err
+		}
+	case r.entropy > 0:
+		if rc.MinLength <= 0 {
+			rc.MinLength = defaultEntropyMinLength
+		}
+		r.re = regexp.MustCompile(fmt.Sprintf(`%s{%d,}`, tokenChars, rc.MinLength))
+	default:
+		return nil, errors.New("either pattern or entropy is required")
+	}
+	return r, nil
+}
+
+// find returns positions of text matching rule.
+func (r *policyRule) find(text string) [][]int {
+	spans := r.re.FindAllStringIndex(text, -1)
+	if r.entropy <= 0 {
+		return spans
+	}
+	matched := spans[:0]
+	for _, s := range spans {
+		if entropy(text[s[0]:s[1]]) >= r.entropy {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+// entropy calculates Shannon entropy of s in bits per byte.
+func entropy(s string) float64 {
+	if len(s) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	e, n := 0.0, float64(len(s))
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / n
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
+
+// redact replaces parts of text with rule name.
+func redact(text string, spans [][]int, name string) string {
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		b.WriteString(text[last:s[0]])
+		b.WriteString("[REDACTED:" + name + "]")
+		last = s[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func (p *Policy) check(text string) verdict {
+	v := verdict{text: text}
+	if p == nil {
+		return v
+	}
+	for _, r := range p.rules {
+		spans := r.find(v.text)
+		if len(spans) == 0 {
+			continue
+		}
+		v.fired = append(v.fired, r.name)
+		switch r.action {
+		case PolicyReject:
+			v.rejected = r.name
+			return v
+		case PolicyRedact:
+			v.text = redact(v.text, spans, r.name)
+		case PolicySensitive:
+			v.sensitive = true
+		}
+	}
+	return v
+}
+
+// LoadPolicy makes service check all clipboard text it receives and sends against policy in file.
+func (s *Service) LoadPolicy(path string) error {
+	p, err := LoadPolicy(path)
+	if err != nil {
+		return err
+	}
+	s.policy = p
+	return nil
+}
+
+// UseBuiltinPolicy makes service check all clipboard text it receives and sends against built-in rules only.
+func (s *Service) UseBuiltinPolicy() error {
+	p, err := newPolicy(&policyConfig{})
+	if err != nil {
+		return err
+	}
+	s.policy = p
+	return nil
+}
+
+// applyPolicy checks text copied or pasted by peer, returns text to use instead and if it is sensitive.
+func (s *Service) applyPolicy(name string, peer net.Addr, text string) (string, bool, error) {
+	v := s.policy.check(text)
+	if len(v.fired) == 0 {
+		return text, false, nil
+	}
+	if len(v.rejected) > 0 {
+		log.Printf("lemonade %s request from '%s' rejected by policy rule '%s'", name, peer, v.rejected)
+		return "", false, fmt.Errorf("%w: content matches rule '%s'", ErrPolicy, v.rejected)
+	}
+	log.Printf("lemonade %s request from '%s' matches policy rules: %s", name, peer, strings.Join(v.fired, ", "))
+	return v.text, v.sensitive, nil
+}
+
+// keptText returns text to keep in history or relay store according to policy, redacted if rules say so, and false
+// if it should not be kept at all.
+func (s *Service) keptText(text string) (string, bool) {
+	v := s.policy.check(text)
+	if v.sensitive || len(v.rejected) > 0 {
+		return "", false
+	}
+	return v.text, true
+}
+
+// clearSensitive clears selection after configured time unless its content was changed since.
+func (s *Service) clearSensitive(sel, text string) {
+	if s.policy == nil || s.policy.clearAfter <= 0 {
+		return
+	}
+	time.AfterFunc(s.policy.clearAfter, func() {
+		current, err := s.readFormat(sel, param.MIMEText)
+		if err != nil || string(current) != text {
+			return
+		}
+		if err := s.writeFormat(sel, param.ClipboardFormat{MIME: param.MIMEText}); err != nil {
+			log.Printf("lemonade unable to clear sensitive clipboard content: %s", err.Error())
+			return
+		}
+		log.Printf("lemonade cleared sensitive clipboard content after %s", s.policy.clearAfter)
+		s.changed("", historyLocal, "")
+	})
+}
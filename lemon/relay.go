@@ -0,0 +1,176 @@
+package lemon
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+// ErrOpenDisabled is returned by relay server which has no command to open URIs with.
+var ErrOpenDisabled = errors.New("opening URIs is disabled on relay server")
+
+// relayBackend keeps clipboard in memory for relay server, every change is saved to store file if one is configured.
+// Selections holding text which is not allowed to be kept are left out of store, text is saved redacted if necessary.
+type relayBackend struct {
+	*memoryBackend
+	mu   sync.Mutex // serializes changes with saving them
+	path string
+	keep func(text string) (string, bool)
+}
+
+func newRelayBackend(path string) (ClipboardBackend, error) {
+	b := &relayBackend{memoryBackend: newMemoryBackend(), path: path}
+	if len(path) == 0 {
+		return b, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read relay store: %w", err)
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&b.sel); err != nil {
+		return nil, fmt.Errorf("unable to decode relay store '%s': %w", path, err)
+	}
+	return b, nil
+}
+
+func (b *relayBackend) save() error {
+	if len(b.path) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	b.memoryBackend.mu.Lock()
+	sel := b.sel
+	if b.keep != nil {
+		sel = make(map[string]map[string][]byte, len(b.sel))
+		for name, content := range b.sel {
+			text, ok := content[""]
+			if !ok {
+				sel[name] = content
+				continue
+			}
+			kept, ok := b.keep(string(text))
+			if !ok {
+				continue
+			}
+			if kept != string(text) {
+				redacted := make(map[string][]byte, len(content))
+				for mime, data := range content {
+					redacted[mime] = data
+				}
+				redacted[""] = []byte(kept)
+				content = redacted
+			}
+			sel[name] = content
+		}
+	}
+	err := gob.NewEncoder(&buf).Encode(sel)
+	b.memoryBackend.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(b.path, buf.Bytes()); err != nil {
+		return fmt.Errorf("unable to save relay store: %w", err)
+	}
+	return nil
+}
+
+func (b *relayBackend) change(f func() error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := f(); err != nil {
+		return err
+	}
+	return b.save()
+}
+
+func (b *relayBackend) WriteAll(text string) error {
+	return b.change(func() error { return b.memoryBackend.WriteAll(text) })
+}
+
+func (b *relayBackend) WriteTyped(f param.ClipboardFormat) error {
+	return b.change(func() error { return b.memoryBackend.WriteTyped(f) })
+}
+
+func (b *relayBackend) WriteFormats(sel string, fs []param.ClipboardFormat) error {
+	return b.change(func() error { return b.memoryBackend.WriteFormats(sel, fs) })
+}
+
+func (b *relayBackend) WritePrimary(f param.ClipboardFormat) error {
+	return b.change(func() error { return b.memoryBackend.WritePrimary(f) })
+}
+
+// openURI opens URI with configured command, default browser or refuses to do so in relay mode.
+func (s *Service) openURI(uri string) error {
+	switch {
+	case len(s.cli.OpenCmd) > 0:
+		name, args := shell(s.cli.OpenCmd, uri)
+		if runtime.GOOS == "windows" {
+			var err error
+			if name, args, err = directCommand(s.cli.OpenCmd, uri); err != nil {
+				return err
+			}
+		}
+		return feedTool(nil, name, args...)
+	case s.cli.Relay:
+		return ErrOpenDisabled
+	default:
+		return openURI(uri)
+	}
+}
+
+// characters cmd.exe interprets even in arguments of batch files
+const cmdMetachars = "\"&|<>^%!()\r\n"
+
+// directCommand prepares to run command with URI as the last argument without shell. On Windows remote URI must
+// never reach cmd.exe, which would interpret its metacharacters, so command line is split into words here: double
+// quotes group words, there are no escapes.
+func directCommand(cmd, uri string) (string, []string, error) {
+	var (
+		words  []string
+		word   strings.Builder
+		quoted bool
+		inWord bool
+	)
+	for _, r := range cmd {
+		switch {
+		case r == '"':
+			quoted, inWord = !quoted, true
+		case (r == ' ' || r == '\t') && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return "", nil, fmt.Errorf("unbalanced quotes in open command '%s'", cmd)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if len(words) == 0 {
+		return "", nil, errors.New("empty open command")
+	}
+	// batch files are always run by cmd.exe
+	if ext := strings.ToLower(filepath.Ext(words[0])); (ext == ".bat" || ext == ".cmd") && strings.ContainsAny(uri, cmdMetachars) {
+		return "", nil, fmt.Errorf("refusing to pass URI with shell metacharacters to batch file '%s'", words[0])
+	}
+	return words[0], append(words[1:], uri), nil
+}
@@ -0,0 +1,123 @@
+package lemon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+// ErrSelectionUnsupported is returned when PRIMARY selection is requested from server which does not have it.
+var ErrSelectionUnsupported = errors.New("PRIMARY selection is not supported by server")
+
+// CheckSelection validates selection name.
+func CheckSelection(sel string) error {
+	switch strings.ToLower(sel) {
+	case "", param.SelectionClipboard, param.SelectionPrimary, param.SelectionBoth:
+		return nil
+	default:
+		return fmt.Errorf("unknown selection '%s', should be one of %s, %s or %s", sel,
+			param.SelectionClipboard, param.SelectionPrimary, param.SelectionBoth)
+	}
+}
+
+// IsPrimary checks if selection involves PRIMARY selection.
+func IsPrimary(sel string) bool {
+	sel = strings.ToLower(sel)
+	return sel == param.SelectionPrimary || sel == param.SelectionBoth
+}
+
+// checkSelection validates selection requested from server.
+func (s *Service) checkSelection(sel string) error {
+	if err := CheckSelection(sel); err != nil {
+		return err
+	}
+	if _, ok := s.backend.(SelectionBackend); !ok && IsPrimary(sel) {
+		return ErrSelectionUnsupported
+	}
+	return nil
+}
+
+func (s *Service) typed() (TypedBackend, error) {
+	if tb, ok := s.backend.(TypedBackend); ok {
+		return tb, nil
+	}
+	return nil, fmt.Errorf("%w: '%s' clipboard backend keeps text only", ErrTypedUnsupported, s.cli.Backend)
+}
+
+// writeFormat sets content of selection, text is expected to be already converted.
+func (s *Service) writeFormat(sel string, f param.ClipboardFormat) error {
+	sel = strings.ToLower(sel)
+	if sel != param.SelectionPrimary {
+		var err error
+		if IsText(f.MIME) {
+			err = s.backend.WriteAll(string(f.Data))
+		} else {
+			var tb TypedBackend
+			if tb, err = s.typed(); err == nil {
+				err = tb.WriteTyped(f)
+			}
+		}
+		if err != nil || sel != param.SelectionBoth {
+			return err
+		}
+	}
+	sb, ok := s.backend.(SelectionBackend)
+	if !ok {
+		return ErrSelectionUnsupported
+	}
+	if IsText(f.MIME) {
+		f.MIME = ""
+	}
+	return sb.WritePrimary(f)
+}
+
+// writeFormats sets content of selection to alternative formats and returns ones which were kept: all of them when
+// backend is able to, otherwise the first one backend accepts.
+func (s *Service) writeFormats(sel string, fs []param.ClipboardFormat) ([]param.ClipboardFormat, error) {
+	if mb, ok := s.backend.(MultiTypedBackend); ok {
+		return fs, mb.WriteFormats(sel, fs)
+	}
+	var errs []string
+	for _, f := range fs {
+		err := s.writeFormat(sel, f)
+		if err == nil {
+			return []param.ClipboardFormat{f}, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", f.MIME, err.Error()))
+	}
+	return nil, errors.New(strings.Join(errs, "; "))
+}
+
+// readFormat gets content of requested type from selection.
+func (s *Service) readFormat(sel, mime string) ([]byte, error) {
+	sel = strings.ToLower(sel)
+	if IsText(mime) {
+		mime = ""
+	}
+	if sel != param.SelectionPrimary {
+		var (
+			data []byte
+			err  error
+		)
+		if len(mime) == 0 {
+			var text string
+			text, err = s.backend.ReadAll()
+			data = []byte(text)
+		} else {
+			var tb TypedBackend
+			if tb, err = s.typed(); err == nil {
+				data, err = tb.ReadTyped(mime)
+			}
+		}
+		if sel != param.SelectionBoth || (err == nil && len(data) > 0) {
+			return data, err
+		}
+	}
+	sb, ok := s.backend.(SelectionBackend)
+	if !ok {
+		return nil, ErrSelectionUnsupported
+	}
+	return sb.ReadPrimary(mime)
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !freebsd && !netbsd && !openbsd && !dragonfly && !darwin
+// +build !linux,!freebsd,!netbsd,!openbsd,!dragonfly,!darwin
+
+package lemon
+
+// There is neither PRIMARY selection nor typed content on this platform, clipboard keeps text only.
+func newSystemBackend() ClipboardBackend {
+	return systemBackend{}
+}
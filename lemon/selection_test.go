@@ -0,0 +1,93 @@
+package lemon
+
+import (
+	"net"
+	"testing"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+func TestCheckSelection(t *testing.T) {
+	for _, sel := range []string{"", "clipboard", "primary", "both", "PRIMARY"} {
+		if err := CheckSelection(sel); err != nil {
+			t.Errorf("Unexpected error for '%s': %v", sel, err)
+		}
+	}
+	if err := CheckSelection("secondary"); err == nil {
+		t.Errorf("Expected error for unknown selection")
+	}
+}
+
+func TestServiceSelection(t *testing.T) {
+
+	m := newMemClipboard()
+	rc := dialService(t, NewService(New(), m), &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	copyText := func(sel, text string) error {
+		p := &param.CopyTypedParam{Formats: []param.ClipboardFormat{{Data: []byte(text)}}, Selection: sel}
+		return rc.Call("Clipboard.CopyTyped", p, dummy)
+	}
+	pasteText := func(sel string) (string, error) {
+		var resp param.ClipboardFormat
+		err := rc.Call("Clipboard.PasteTyped", &param.PasteTypedParam{Types: []string{""}, Selection: sel}, &resp)
+		return string(resp.Data), err
+	}
+	assert := func(clipboard, primary string) {
+		t.Helper()
+		c, _ := m.ReadAll()
+		p, _ := m.ReadPrimary("")
+		if c != clipboard || string(p) != primary {
+			t.Errorf("Expected '%s' '%s', but got '%s' '%s'", clipboard, primary, c, string(p))
+		}
+	}
+
+	if err := copyText("clipboard", "clip"); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyText("primary", "prim"); err != nil {
+		t.Fatal(err)
+	}
+	assert("clip", "prim")
+
+	if text, err := pasteText("primary"); err != nil || text != "prim" {
+		t.Errorf("Expected 'prim', but got '%s' '%v'", text, err)
+	}
+	if text, err := pasteText("both"); err != nil || text != "clip" {
+		t.Errorf("Expected 'clip', but got '%s' '%v'", text, err)
+	}
+
+	if err := copyText("both", "both"); err != nil {
+		t.Fatal(err)
+	}
+	assert("both", "both")
+
+	// empty clipboard falls back to primary
+	if err := m.WriteAll(""); err != nil {
+		t.Fatal(err)
+	}
+	if text, err := pasteText("both"); err != nil || text != "both" {
+		t.Errorf("Expected 'both', but got '%s' '%v'", text, err)
+	}
+
+	if err := copyText("secondary", "text"); err == nil {
+		t.Errorf("Expected error for unknown selection")
+	}
+}
+
+func TestServiceSelectionUnsupported(t *testing.T) {
+
+	// hide optional interfaces
+	b := struct{ ClipboardBackend }{newMemoryBackend()}
+	rc := dialService(t, NewService(New(), b), &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	p := &param.CopyTypedParam{Formats: []param.ClipboardFormat{{Data: []byte("text")}}, Selection: "primary"}
+	if err := rc.Call("Clipboard.CopyTyped", p, dummy); err == nil || err.Error() != ErrSelectionUnsupported.Error() {
+		t.Errorf("Expected '%v', but got '%v'", ErrSelectionUnsupported, err)
+	}
+	p = &param.CopyTypedParam{Formats: []param.ClipboardFormat{{MIME: "image/png", Data: []byte("png")}}}
+	if err := rc.Call("Clipboard.CopyTyped", p, dummy); err == nil {
+		t.Errorf("Expected error for typed content")
+	}
+}
@@ -0,0 +1,178 @@
+package lemon
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"time"
+)
+
+// Codec defines how rpc requests are encoded on connection.
+type Codec int
+
+// Codecs
+const (
+	CodecGob Codec = iota
+	CodecJSON
+	CodecAuto // detected from the first byte sent by client
+)
+
+// Service holds "lemonade" server state shared by all connections.
+type Service struct {
+	cli     *CLI
+	backend ClipboardBackend
+	limiter *rateLimiter
+	history *historyRing
+	watch   *watchState
+	policy  *Policy
+	stat    statState
+}
+
+// NewService initializes Service structure keeping clipboard content in backend.
+func NewService(c *CLI, b ClipboardBackend) *Service {
+	s := &Service{
+		cli:     c,
+		backend: b,
+		limiter: newRateLimiter(c.RateLimit, c.RateBurst),
+		history: newHistoryRing(c.HistorySize, c.HistoryMaxBytes, c.HistoryExclude),
+		watch:   newWatchState(),
+	}
+	if rb, ok := b.(*relayBackend); ok {
+		// relay store gets the same text history would keep
+		rb.keep = s.keptText
+	}
+	return s
+}
+
+type callResult struct {
+	text string
+	err  error
+}
+
+// call runs f failing if it takes longer than call timeout. In such case f continues to run in background,
+// there is no way to interrupt system clipboard or browser.
+func (s *Service) call(name string, peer net.Addr, f func() (string, error)) (string, error) {
+
+	if s.cli.CallTimeout <= 0 {
+		return f()
+	}
+
+	done := make(chan callResult, 1)
+	go func() {
+		text, err := f()
+		done <- callResult{text: text, err: err}
+	}()
+
+	timer := time.NewTimer(s.cli.CallTimeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-done:
+		return res.text, res.err
+	case <-timer.C:
+		if s.cli.Debug {
+			log.Printf("lemonade %s request from '%s' timed out after %s", name, peer, s.cli.CallTimeout)
+		}
+		return "", fmt.Errorf("%s call timed out after %s", name, s.cli.CallTimeout)
+	}
+}
+
+// Creates Clipboard serving connection. Replaceable for testing.
+var connClipboard = NewClipboard
+
+// NewRPCServer creates rpc server with its own service instances bound to connection peer, so calls from
+// different connections never share per connection information.
+func (s *Service) NewRPCServer(peer net.Addr) (*rpc.Server, error) {
+	rs, _, err := s.newRPCServer(peer)
+	return rs, err
+}
+
+// newRPCServer is NewRPCServer also returning Clipboard instance, so its transfers could be released when
+// connection is gone.
+func (s *Service) newRPCServer(peer net.Addr) (*rpc.Server, *Clipboard, error) {
+
+	rs := rpc.NewServer()
+	if err := rs.Register(NewURI(s, peer)); err != nil {
+		return nil, nil, fmt.Errorf("unable to register URI rpc: %w", err)
+	}
+	clip := connClipboard(s, peer)
+	if err := rs.Register(clip); err != nil {
+		return nil, nil, fmt.Errorf("unable to register Clipboard rpc: %w", err)
+	}
+	if err := rs.Register(NewHistory(s, peer)); err != nil {
+		return nil, nil, fmt.Errorf("unable to register History rpc: %w", err)
+	}
+	if err := rs.RegisterName("Server", NewInfo(s)); err != nil {
+		return nil, nil, fmt.Errorf("unable to register Server rpc: %w", err)
+	}
+	return rs, clip, nil
+}
+
+// bufferedConn allows to look at incoming data before rpc codec starts reading it.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (bc *bufferedConn) Read(p []byte) (int, error) {
+	return bc.r.Read(p)
+}
+
+// detectCodec peeks at the first byte of client request. Gob encoded stream always starts with the length of
+// message, while JSON-RPC request is an object, possibly preceded by white space.
+func detectCodec(conn net.Conn) (net.Conn, Codec, error) {
+	bc := &bufferedConn{Conn: conn, r: bufio.NewReader(conn)}
+	b, err := bc.r.Peek(1)
+	if err != nil {
+		return nil, CodecGob, err
+	}
+	switch b[0] {
+	case '{', ' ', '\t', '\r', '\n':
+		return bc, CodecJSON, nil
+	default:
+		return bc, CodecGob, nil
+	}
+}
+
+// CallTracker is implemented by connections which need to know when calls read from them are being executed, for
+// example not to consider connection idle meanwhile. Every started call is finished when its response is written.
+type CallTracker interface {
+	CallStarted()
+	CallFinished()
+}
+
+// ServeConn serves rpc requests on connection until client hangs up.
+func (s *Service) ServeConn(conn net.Conn, codec Codec) error {
+
+	rs, clip, err := s.newRPCServer(conn.RemoteAddr())
+	if err != nil {
+		return err
+	}
+	// unfinished transfers could never be completed once connection is gone
+	defer clip.release()
+
+	tracker := conn
+	if codec == CodecAuto {
+		if conn, codec, err = detectCodec(conn); err != nil {
+			return fmt.Errorf("unable to detect rpc codec: %w", err)
+		}
+	}
+
+	var sc rpc.ServerCodec
+	switch codec {
+	case CodecJSON:
+		if s.cli.Debug {
+			log.Printf("lemonade serving JSON-RPC to '%s'", conn.RemoteAddr())
+		}
+		sc = s.newJSONCodec(conn)
+	default:
+		sc = s.newGobCodec(conn)
+	}
+	if ct, ok := tracker.(CallTracker); ok {
+		sc = &trackingCodec{ServerCodec: sc, ct: ct}
+	}
+	rs.ServeCodec(sc)
+	return nil
+}
@@ -0,0 +1,310 @@
+package lemon
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+var dummy = &struct{}{}
+
+// memClipboard keeps clipboard in memory and records opened URIs for tests.
+type memClipboard struct {
+	*memoryBackend
+	sync.Mutex
+	opened map[string]int
+}
+
+func newMemClipboard() *memClipboard {
+	m := &memClipboard{memoryBackend: newMemoryBackend(), opened: make(map[string]int)}
+	openURI = func(uri string) error {
+		m.Lock()
+		defer m.Unlock()
+		m.opened[uri]++
+		return nil
+	}
+	return m
+}
+
+// peerConn pretends to be connected to peer.
+type peerConn struct {
+	net.Conn
+	peer net.Addr
+}
+
+func (c *peerConn) RemoteAddr() net.Addr {
+	return c.peer
+}
+
+// dialService connects rpc client to per connection rpc server over in-memory pipe.
+func dialService(t *testing.T, svc *Service, peer net.Addr) *rpc.Client {
+	t.Helper()
+
+	sc, cc := net.Pipe()
+	go func() { _ = svc.ServeConn(&peerConn{Conn: sc, peer: peer}, CodecGob) }()
+	return rpc.NewClient(cc)
+}
+
+func TestServiceMultipleCalls(t *testing.T) {
+
+	m := newMemClipboard()
+	svc := NewService(New(), m)
+
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	for i := 0; i < 3; i++ {
+		text := fmt.Sprintf("text %d", i)
+		if err := rc.Call("Clipboard.Copy", text, dummy); err != nil {
+			t.Fatal(err)
+		}
+		var resp string
+		if err := rc.Call("Clipboard.Paste", dummy, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp != text {
+			t.Errorf("Expected: '%s', but got '%s'", text, resp)
+		}
+	}
+}
+
+func TestServiceParallelClients(t *testing.T) {
+
+	m := newMemClipboard()
+	svc := NewService(New(), m)
+
+	const (
+		clients = 10
+		calls   = 20
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			rc := dialService(t, svc, &net.TCPAddr{IP: net.IPv4(10, 0, 0, byte(i))})
+			defer rc.Close()
+
+			for j := 0; j < calls; j++ {
+				p := &param.OpenParam{URI: "http://127.0.0.1:8080/foo", TransLoopback: true}
+				if err := rc.Call("URI.Open", p, dummy); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := rc.Call("Clipboard.Copy", fmt.Sprintf("%d-%d", i, j), dummy); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	m.Lock()
+	defer m.Unlock()
+
+	if len(m.opened) != clients {
+		t.Errorf("Expected %d different URIs, but got %d: %v", clients, len(m.opened), m.opened)
+	}
+	for i := 0; i < clients; i++ {
+		uri := fmt.Sprintf("http://10.0.0.%d:8080/foo", i)
+		if m.opened[uri] != calls {
+			t.Errorf("Expected %d calls for '%s', but got %d", calls, uri, m.opened[uri])
+		}
+	}
+}
+
+func TestServiceCodecDetection(t *testing.T) {
+
+	m := newMemClipboard()
+	svc := NewService(New(), m)
+
+	assert := func(newClient func(io.ReadWriteCloser) *rpc.Client, text string) {
+		sc, cc := net.Pipe()
+		go func() { _ = svc.ServeConn(sc, CodecAuto) }()
+
+		rc := newClient(cc)
+		defer rc.Close()
+
+		if err := rc.Call("Clipboard.Copy", text, dummy); err != nil {
+			t.Fatal(err)
+		}
+		var resp string
+		if err := rc.Call("Clipboard.Paste", struct{}{}, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp != text {
+			t.Errorf("Expected: '%s', but got '%s'", text, resp)
+		}
+	}
+
+	assert(rpc.NewClient, "gob")
+	assert(jsonrpc.NewClient, "json")
+}
+
+func TestServiceInfo(t *testing.T) {
+
+	c := New()
+	c.JSONRPC = true
+	svc := NewService(c, newMemoryBackend())
+
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	info := c.ServerInfo(rc)
+	if info.ProtocolVersion != param.ProtocolVersion {
+		t.Errorf("Expected protocol version %d, but got %d", param.ProtocolVersion, info.ProtocolVersion)
+	}
+	if !info.Has(param.CapJSONRPC) || info.Has(param.CapHTTP) || !info.Has(param.CapTyped) || !info.Has(param.CapSelection) {
+		t.Errorf("Unexpected capabilities: %v", info.Capabilities)
+	}
+
+	// capabilities depend on backend
+	c = New()
+	svc = NewService(c, struct{ ClipboardBackend }{newMemoryBackend()})
+	rc = dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	if info = c.ServerInfo(rc); info.Has(param.CapTyped) || info.Has(param.CapSelection) {
+		t.Errorf("Unexpected capabilities for text only backend: %v", info.Capabilities)
+	}
+}
+
+// blockingBackend does not return clipboard content until unblocked.
+type blockingBackend struct {
+	ClipboardBackend
+	block chan struct{}
+}
+
+func (b *blockingBackend) ReadAll() (string, error) {
+	<-b.block
+	return "late", nil
+}
+
+func TestServiceCallTimeout(t *testing.T) {
+
+	m := newMemClipboard()
+	block := make(chan struct{})
+	defer close(block)
+
+	c := New()
+	c.CallTimeout = 10 * time.Millisecond
+	svc := NewService(c, &blockingBackend{ClipboardBackend: m, block: block})
+
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	var resp string
+	if err := rc.Call("Clipboard.Paste", dummy, &resp); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected timeout, but got '%v'", err)
+	}
+	// connection is still usable
+	if err := rc.Call("Clipboard.Copy", "text", dummy); err != nil {
+		t.Errorf("Expected success, but got '%v'", err)
+	}
+}
+
+func TestServiceTyped(t *testing.T) {
+
+	m := newMemClipboard()
+	svc := NewService(New(), m)
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	png := []byte{0x89, 'P', 'N', 'G', 0, 1, 2}
+	p := &param.CopyTypedParam{Formats: []param.ClipboardFormat{{MIME: "image/png", Data: png}}}
+	if err := rc.Call("Clipboard.CopyTyped", p, dummy); err != nil {
+		t.Fatal(err)
+	}
+
+	var resp param.ClipboardFormat
+	if err := rc.Call("Clipboard.PasteTyped", &param.PasteTypedParam{Types: []string{"image/jpeg", "image/png"}}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.MIME != "image/png" || string(resp.Data) != string(png) {
+		t.Errorf("Unexpected typed content: '%s' %v", resp.MIME, resp.Data)
+	}
+
+	// text is handled by regular clipboard
+	p = &param.CopyTypedParam{Formats: []param.ClipboardFormat{{MIME: "text/plain", Data: []byte("text")}}}
+	if err := rc.Call("Clipboard.CopyTyped", p, dummy); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Call("Clipboard.PasteTyped", &param.PasteTypedParam{Types: []string{""}}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.MIME != param.MIMEText || string(resp.Data) != "text" {
+		t.Errorf("Unexpected text content: '%s' '%s'", resp.MIME, string(resp.Data))
+	}
+
+	err := rc.Call("Clipboard.PasteTyped", &param.PasteTypedParam{Types: []string{"image/gif"}}, &resp)
+	if err == nil || !strings.Contains(err.Error(), ErrTypeUnavailable.Error()) {
+		t.Errorf("Expected unavailable type error, but got '%v'", err)
+	}
+}
+
+func TestServiceTypedFormats(t *testing.T) {
+
+	png := []byte{0x89, 'P', 'N', 'G', 0, 1, 2}
+	p := &param.CopyTypedParam{Formats: []param.ClipboardFormat{{MIME: "image/png", Data: png}, {MIME: param.MIMEText, Data: []byte("text")}}}
+
+	paste := func(rc *rpc.Client, mime string) string {
+		t.Helper()
+		var resp param.ClipboardFormat
+		if err := rc.Call("Clipboard.PasteTyped", &param.PasteTypedParam{Types: []string{mime}}, &resp); err != nil {
+			return err.Error()
+		}
+		return string(resp.Data)
+	}
+
+	// memory keeps all formats
+	m := newMemClipboard()
+	rc := dialService(t, NewService(New(), m), &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+	if err := rc.Call("Clipboard.CopyTyped", p, dummy); err != nil {
+		t.Fatal(err)
+	}
+	if got := paste(rc, "image/png"); got != string(png) {
+		t.Errorf("Expected png to be kept, but got '%s'", got)
+	}
+	if got := paste(rc, param.MIMEText); got != "text" {
+		t.Errorf("Expected text to be kept, but got '%s'", got)
+	}
+
+	// backend holding one type at a time gets the first one it accepts
+	b := newMemoryBackend()
+	rc = dialService(t, NewService(New(), struct {
+		ClipboardBackend
+		TypedBackend
+	}{b, b}), &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+	if err := rc.Call("Clipboard.CopyTyped", p, dummy); err != nil {
+		t.Fatal(err)
+	}
+	if got := paste(rc, "image/png"); got != string(png) {
+		t.Errorf("Expected png to be kept, but got '%s'", got)
+	}
+	if text, _ := b.ReadAll(); len(text) != 0 {
+		t.Errorf("Expected only preferred format to be kept, but got text '%s'", text)
+	}
+
+	b = newMemoryBackend()
+	rc = dialService(t, NewService(New(), struct{ ClipboardBackend }{b}), &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+	if err := rc.Call("Clipboard.CopyTyped", p, dummy); err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := b.ReadAll(); text != "text" {
+		t.Errorf("Expected text only backend to keep text, but got '%s'", text)
+	}
+}
@@ -0,0 +1,121 @@
+package lemon
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+// statState keeps metadata of the last clipboard change.
+type statState struct {
+	mu   sync.Mutex
+	stat param.ClipboardStat // zero Time until clipboard is observed for the first time
+}
+
+// author describes client changing clipboard.
+type author struct {
+	origin string // opaque tag reported back by "Clipboard.Watch"
+	host   string
+	user   string
+}
+
+// newStat describes content of declared type set by source.
+func newStat(source, mime string, data []byte) param.ClipboardStat {
+	st := param.ClipboardStat{
+		Source: source,
+		Time:   time.Now(),
+		Size:   len(data),
+		MIME:   detectMIME(mime, data),
+		Hash:   HashBytes(data),
+	}
+	if IsText(mime) {
+		st.Lines = countLines(data)
+	}
+	return st
+}
+
+// detectMIME finds type of content from its data. Text is reported as HTML or XML when it looks like one, declared
+// type is kept when data is not recognized or looks like text, which covers types based on text, JSON or SVG.
+func detectMIME(mime string, data []byte) string {
+	detected := http.DetectContentType(data)
+	switch {
+	case IsText(mime) && strings.HasPrefix(detected, "text/") && !IsText(detected):
+		return detected
+	case IsText(mime):
+		return param.MIMEText
+	case detected == "application/octet-stream" || strings.HasPrefix(detected, "text/"):
+		return mime
+	default:
+		return detected
+	}
+}
+
+// countLines counts lines of text, the last line does not have to end with new line.
+func countLines(data []byte) int {
+	if len(data) == 0 {
+		return 0
+	}
+	n := bytes.Count(data, []byte{'\n'})
+	if data[len(data)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// recordStat remembers metadata of content which became current.
+func (s *Service) recordStat(st param.ClipboardStat) {
+	s.stat.mu.Lock()
+	defer s.stat.mu.Unlock()
+	s.stat.stat = st
+}
+
+// recordLocal remembers metadata of clipboard text changed on server desktop. Text already described keeps its
+// metadata. Clipboard holding content which is not text is usually read as empty text, so it is not mistaken for a
+// change.
+func (s *Service) recordLocal(text string) {
+	s.stat.mu.Lock()
+	defer s.stat.mu.Unlock()
+	if !s.stat.stat.Time.IsZero() {
+		if s.stat.stat.Hash == HashText(text) {
+			return
+		}
+		if len(text) == 0 && !strings.HasPrefix(s.stat.stat.MIME, "text/") {
+			return
+		}
+	}
+	s.stat.stat = newStat(historyLocal, param.MIMEText, []byte(text))
+}
+
+// recordCopy remembers metadata of content set by client.
+func (c *Clipboard) recordCopy(mime string, data []byte, by author) {
+	st := newStat(peerSource(c.peer), mime, data)
+	st.Host, st.User = by.host, by.user
+	c.svc.recordStat(st)
+}
+
+// Stat is implementation of "lemonade" rpc "stat" command: it describes the last clipboard change.
+func (c *Clipboard) Stat(_ struct{}, resp *param.ClipboardStat) error {
+	if err := c.svc.checkRate(c.peer); err != nil {
+		return err
+	}
+
+	// clipboard may have changed since it was observed last, when it is not monitored this is the only way to know
+	text, err := c.svc.call("Stat", c.peer, c.svc.backend.ReadAll)
+	if err != nil {
+		return err
+	}
+	c.svc.recordLocal(text)
+
+	c.svc.stat.mu.Lock()
+	*resp = c.svc.stat.stat
+	c.svc.stat.mu.Unlock()
+	if c.cli.Debug {
+		log.Printf("lemonade Stat request from '%s': '%+v'", c.peer, *resp)
+	}
+	return nil
+}
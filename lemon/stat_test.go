@@ -0,0 +1,151 @@
+package lemon
+
+import (
+	"net"
+	"testing"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+func TestCountLines(t *testing.T) {
+	assert := func(text string, expected int) {
+		t.Helper()
+		if n := countLines([]byte(text)); n != expected {
+			t.Errorf("Expected %d lines in %q, but got %d", expected, text, n)
+		}
+	}
+
+	assert("", 0)
+	assert("one", 1)
+	assert("one\n", 1)
+	assert("one\ntwo", 2)
+	assert("one\r\ntwo\r\n", 2)
+	assert("\n\n", 2)
+}
+
+func TestServiceStat(t *testing.T) {
+
+	m := newMemClipboard()
+	c := New()
+	c.HistorySize = 10
+	svc := NewService(c, m)
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	stat := func() param.ClipboardStat {
+		t.Helper()
+		var st param.ClipboardStat
+		if err := rc.Call("Clipboard.Stat", dummy, &st); err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+
+	// clipboard is read when nothing is known about it yet
+	_, _, changed := svc.watch.current()
+	_ = m.WriteAll("local\ntext")
+	st := stat()
+	if st.Source != historyLocal || st.Size != 10 || st.Lines != 2 || st.MIME != param.MIMEText || st.Hash != HashText("local\ntext") || st.Time.IsZero() {
+		t.Errorf("Unexpected stat of local text: %+v", st)
+	}
+	if n := len(svc.history.list()); n != 0 {
+		t.Errorf("Expected stat not to add history entries, but got %d", n)
+	}
+	select {
+	case <-changed:
+		t.Errorf("Expected stat not to wake watchers")
+	default:
+	}
+	if again := stat(); again.Time != st.Time {
+		t.Errorf("Expected unchanged text to keep its metadata, but got %+v", again)
+	}
+
+	if err := rc.Call("Clipboard.Copy", "remote", dummy); err != nil {
+		t.Fatal(err)
+	}
+	st = stat()
+	if st.Source != "192.168.0.1" || len(st.Host) != 0 || st.Size != 6 || st.Lines != 1 || st.Hash != HashText("remote") {
+		t.Errorf("Unexpected stat of copied text: %+v", st)
+	}
+
+	// the same text copied by another client changes its source
+	p := &param.CopyTypedParam{Formats: []param.ClipboardFormat{{MIME: param.MIMEText, Data: []byte("remote")}}, Host: "box", User: "me"}
+	if err := rc.Call("Clipboard.CopyTyped", p, dummy); err != nil {
+		t.Fatal(err)
+	}
+	if st = stat(); st.Host != "box" || st.User != "me" || st.Hash != HashText("remote") {
+		t.Errorf("Unexpected stat of typed copy: %+v", st)
+	}
+
+	p = &param.CopyTypedParam{Formats: []param.ClipboardFormat{{MIME: "image/png", Data: []byte("\x89PNG")}}, Host: "box", User: "me"}
+	if err := rc.Call("Clipboard.CopyTyped", p, dummy); err != nil {
+		t.Fatal(err)
+	}
+	if st = stat(); st.MIME != "image/png" || st.Size != 4 || st.Lines != 0 || st.Hash != HashBytes([]byte("\x89PNG")) {
+		t.Errorf("Unexpected stat of image: %+v", st)
+	}
+
+	// image is seen as empty text by clipboard monitor
+	svc.changed("", historyLocal, "")
+	if st = stat(); st.MIME != "image/png" {
+		t.Errorf("Expected image to stay current, but got %+v", st)
+	}
+	_ = m.WriteAll("changed locally")
+	svc.changed("changed locally", historyLocal, "")
+	if st = stat(); st.Source != historyLocal || st.Size != 15 || len(st.User) != 0 {
+		t.Errorf("Unexpected stat of local change: %+v", st)
+	}
+
+	// change is noticed even when clipboard is not monitored
+	if err := rc.Call("Clipboard.Copy", "remote", dummy); err != nil {
+		t.Fatal(err)
+	}
+	_ = m.WriteAll("unnoticed")
+	if st = stat(); st.Source != historyLocal || st.Hash != HashText("unnoticed") {
+		t.Errorf("Expected stale metadata to be replaced, but got %+v", st)
+	}
+
+	var info param.InfoResult
+	if err := rc.Call("Server.Info", dummy, &info); err != nil {
+		t.Fatal(err)
+	}
+	if !info.Has(param.CapStat) {
+		t.Errorf("Expected server to advertise '%s' capability, but got %v", param.CapStat, info.Capabilities)
+	}
+}
+
+func TestDetectMIME(t *testing.T) {
+
+	png := []byte("\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0DIHDR")
+	for _, c := range []struct {
+		declared string
+		data     string
+		expected string
+	}{
+		{param.MIMEText, "plain text", param.MIMEText},
+		{"", "", param.MIMEText},
+		{param.MIMEText, "<!DOCTYPE html><html><body>text</body></html>", "text/html; charset=utf-8"},
+		{"image/png", string(png), "image/png"},
+		{"application/octet-stream", string(png), "image/png"},
+		{"image/jpeg", string(png), "image/png"},
+		{"image/svg+xml", `<?xml version="1.0"?><svg/>`, "image/svg+xml"},
+		{"application/x-custom", "\x00\x01\x02", "application/x-custom"},
+	} {
+		if got := detectMIME(c.declared, []byte(c.data)); got != c.expected {
+			t.Errorf("Expected '%s' declared as '%s' to be '%s', but got '%s'", c.data, c.declared, c.expected, got)
+		}
+	}
+
+	// local changes are described by content too
+	m := newMemClipboard()
+	svc := NewService(New(), m)
+	html := "<html><body>copied from browser</body></html>"
+	_ = m.WriteAll(html)
+	svc.changed(html, historyLocal, "")
+	svc.stat.mu.Lock()
+	st := svc.stat.stat
+	svc.stat.mu.Unlock()
+	if st.MIME != "text/html; charset=utf-8" || st.Lines != 1 {
+		t.Errorf("Unexpected stat of local HTML text: %+v", st)
+	}
+}
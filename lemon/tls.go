@@ -0,0 +1,114 @@
+package lemon
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+func loadCertPool(fname string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates found in '%s'", fname)
+	}
+	return pool, nil
+}
+
+func (c *CLI) loadKeyPair() ([]tls.Certificate, error) {
+	if len(c.TLSCert) == 0 && len(c.TLSKey) == 0 {
+		return nil, nil
+	}
+	if len(c.TLSCert) == 0 || len(c.TLSKey) == 0 {
+		return nil, errors.New("both TLS certificate and key must be specified")
+	}
+	cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load TLS key pair: %w", err)
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+// ServerTLSConfig prepares server side TLS configuration.
+func (c *CLI) ServerTLSConfig() (*tls.Config, error) {
+
+	certs, err := c.loadKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("server requires TLS certificate and key")
+	}
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: certs,
+	}
+
+	if len(c.TLSCA) > 0 {
+		pool, err := loadCertPool(c.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+	}
+	if c.TLSVerifyClient {
+		if cfg.ClientCAs == nil {
+			return nil, errors.New("client certificate verification requires TLS CA")
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// ClientTLSConfig prepares client side TLS configuration. When CA is specified it is the only one trusted.
+func (c *CLI) ClientTLSConfig() (*tls.Config, error) {
+
+	certs, err := c.loadKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: certs,
+		ServerName:   c.TLSServerName,
+	}
+	if len(cfg.ServerName) == 0 {
+		if c.IsUnixSocket() {
+			cfg.ServerName = "localhost"
+		} else {
+			cfg.ServerName = c.Host
+		}
+	}
+
+	if len(c.TLSCA) > 0 {
+		pool, err := loadCertPool(c.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// TLSHandshake performs TLS handshake on connection if it is TLS one, so errors could be reported early.
+func TLSHandshake(conn net.Conn, timeout time.Duration) error {
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	defer handshakeDeadline(tc, timeout)()
+
+	if err := tc.Handshake(); err != nil {
+		return fmt.Errorf("TLS handshake error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package lemon
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issue creates certificate signed by parent, self-signed one when parent is nil, and writes it to dir as name.crt
+// and name.key.
+func issue(t *testing.T, dir, name string, parent *testCert, ca bool, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	if ca {
+		tmpl.IsCA = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		tmpl.DNSNames = []string{"localhost"}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	signer := &testCert{cert: tmpl, key: key}
+	if parent != nil {
+		signer = parent
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer.cert, &key.PublicKey, signer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func TestTLSConfig(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "lemonade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := issue(t, dir, "ca", nil, true, 0)
+	issue(t, dir, "server", ca, false, x509.ExtKeyUsageServerAuth)
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	c := New()
+	if _, err := c.ServerTLSConfig(); err == nil {
+		t.Errorf("Expected server to require certificate and key")
+	}
+	c.TLSCert = file("server.crt")
+	if _, err := c.ServerTLSConfig(); err == nil {
+		t.Errorf("Expected server to require key with certificate")
+	}
+	c.TLSKey = file("server.key")
+	c.TLSVerifyClient = true
+	if _, err := c.ServerTLSConfig(); err == nil {
+		t.Errorf("Expected client verification to require CA")
+	}
+	c.TLSCA = file("server.key")
+	if _, err := c.ServerTLSConfig(); err == nil {
+		t.Errorf("Expected failure for CA file without certificates")
+	}
+	c.TLSCA = file("ca.crt")
+	cfg, err := c.ServerTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert || cfg.ClientCAs == nil || len(cfg.Certificates) != 1 {
+		t.Errorf("Expected server to verify client certificates, but got %+v", cfg)
+	}
+
+	c = New()
+	c.Host = "example.com"
+	if cfg, err = c.ClientTLSConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ServerName != c.Host || cfg.RootCAs != nil || len(cfg.Certificates) != 0 {
+		t.Errorf("Expected client to verify host with system roots, but got %+v", cfg)
+	}
+	c.TLSServerName = "localhost"
+	if cfg, err = c.ClientTLSConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ServerName != c.TLSServerName {
+		t.Errorf("Expected server name '%s', but got '%s'", c.TLSServerName, cfg.ServerName)
+	}
+}
+
+func TestTLSHandshake(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "lemonade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := issue(t, dir, "ca", nil, true, 0)
+	issue(t, dir, "server", ca, false, x509.ExtKeyUsageServerAuth)
+	issue(t, dir, "client", ca, false, x509.ExtKeyUsageClientAuth)
+	other := issue(t, dir, "other", nil, true, 0)
+	issue(t, dir, "stranger", other, false, x509.ExtKeyUsageClientAuth)
+	file := func(name string) string {
+		if len(name) == 0 {
+			return ""
+		}
+		return filepath.Join(dir, name)
+	}
+
+	sc := New()
+	sc.TLSCert, sc.TLSKey, sc.TLSCA = file("server.crt"), file("server.key"), file("ca.crt")
+	sc.TLSVerifyClient = true
+	scfg, err := sc.ServerTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert := func(cert, ca string, success bool) {
+		t.Helper()
+
+		c := New()
+		c.Host = "127.0.0.1"
+		c.TLSServerName = "localhost"
+		c.TLSCert, c.TLSKey, c.TLSCA = file(cert+".crt"), file(cert+".key"), file(ca)
+		if len(cert) == 0 {
+			c.TLSCert, c.TLSKey = "", ""
+		}
+		ccfg, err := c.ClientTLSConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ccfg.Certificates) > 0 {
+			// present certificate even when it is not issued by CA server asks for
+			ccfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &ccfg.Certificates[0], nil
+			}
+		}
+
+		// unlike pipe, socket is buffered, so neither side blocks sending alert nobody reads yet
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		done := make(chan error, 1)
+		go func() {
+			s, err := l.Accept()
+			if err != nil {
+				done <- err
+				return
+			}
+			defer s.Close()
+			done <- TLSHandshake(tls.Server(s, scfg), 5*time.Second)
+		}()
+		cl, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cl.Close()
+
+		tc := tls.Client(cl, ccfg)
+		cerr := TLSHandshake(tc, 5*time.Second)
+		if cerr == nil && !success {
+			// with TLS 1.3 client finishes its part before server rejects its certificate
+			_, cerr = tc.Read(make([]byte, 1))
+		}
+		serr := <-done
+
+		if success {
+			if cerr != nil || serr != nil {
+				t.Errorf("Expected success for '%s'/'%s', but got client: '%v', server: '%v'", cert, ca, cerr, serr)
+			}
+			return
+		}
+		if cerr == nil || serr == nil {
+			t.Errorf("Expected failure for '%s'/'%s', but got client: '%v', server: '%v'", cert, ca, cerr, serr)
+		}
+	}
+
+	assert("client", "ca.crt", true)
+	assert("", "ca.crt", false)
+	assert("stranger", "ca.crt", false)
+	// server certificate is not trusted by client
+	assert("client", "other.crt", false)
+
+	if err := TLSHandshake(&net.TCPConn{}, time.Second); err != nil {
+		t.Errorf("Expected plain connection to be left alone, but got '%v'", err)
+	}
+}
@@ -0,0 +1,191 @@
+package lemon
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Direction clipboard text is moving in, every direction has its own transforms. Copied text goes through client
+// chain before it is sent and through server chain when it is received, so both sides could have their own
+// transforms. Line endings are converted by server for copied text and by client for pasted one.
+type Direction int
+
+// Directions
+const (
+	DirCopy  Direction = iota // text is copied: received by server
+	DirPaste                  // text is pasted: received by client
+	DirSend                   // text is copied: sent by client, line endings are left to server
+)
+
+const defaultTabWidth = 8
+
+var (
+	// CSI and OSC sequences and two character escapes
+	ansiRE   = regexp.MustCompile("\x1b\\[[0-?]*[ -/]*[@-~]|\x1b\\][^\x07\x1b]*(?:\x07|\x1b\\\\)|\x1b[@-Z\\\\-_]")
+	crRE     = regexp.MustCompile(`\r(.)|\r$`)
+	lfRE     = regexp.MustCompile(`([^\r])\n|^\n`)
+	builtins = map[string]func(arg string) (func(string) string, error){
+		"lf":           noArg(func(text string) string { return ConvertLineEnding(text, "lf") }),
+		"crlf":         noArg(func(text string) string { return ConvertLineEnding(text, "crlf") }),
+		"trim-newline": noArg(func(text string) string { return strings.TrimRight(text, "\r\n") }),
+		"strip-ansi":   noArg(func(text string) string { return ansiRE.ReplaceAllString(text, "") }),
+		"strip-bom":    noArg(func(text string) string { return strings.TrimPrefix(text, "\ufeff") }),
+		"remove-nul":   noArg(func(text string) string { return strings.Replace(text, "\x00", "", -1) }),
+		"expand-tabs":  expandTabs,
+	}
+)
+
+func noArg(f func(string) string) func(string) (func(string) string, error) {
+	return func(arg string) (func(string) string, error) {
+		if len(arg) != 0 {
+			return nil, fmt.Errorf("unexpected argument '%s'", arg)
+		}
+		return f, nil
+	}
+}
+
+// expandTabs replaces tabs with spaces up to the next tab stop, width is optional argument.
+func expandTabs(arg string) (func(string) string, error) {
+	width := defaultTabWidth
+	if len(arg) != 0 {
+		var err error
+		if width, err = strconv.Atoi(arg); err != nil || width <= 0 {
+			return nil, fmt.Errorf("bad tab width '%s'", arg)
+		}
+	}
+	return func(text string) string {
+		if !strings.Contains(text, "\t") {
+			return text
+		}
+		var b strings.Builder
+		col := 0
+		for _, r := range text {
+			switch r {
+			case '\t':
+				n := width - col%width
+				b.WriteString(strings.Repeat(" ", n))
+				col += n
+			case '\n', '\r':
+				b.WriteRune(r)
+				col = 0
+			default:
+				b.WriteRune(r)
+				col++
+			}
+		}
+		return b.String()
+	}, nil
+}
+
+// ConvertLineEnding normalizes line endings in text to requested ones (LF/CRLF).
+func ConvertLineEnding(text, lineEnding string) string {
+	switch {
+	case strings.EqualFold("lf", lineEnding):
+		text = strings.Replace(text, "\r\n", "\n", -1)
+		return strings.Replace(text, "\r", "\n", -1)
+	case strings.EqualFold("crlf", lineEnding):
+		text = crRE.ReplaceAllString(text, "\r\n$1")
+		text = lfRE.ReplaceAllString(text, "$1\r\n")
+		return text
+	default:
+		return text
+	}
+}
+
+type transform struct {
+	name  string
+	apply func(string) string
+}
+
+// Transforms is ordered list of text transforms, as a flag it accepts comma separated names and could be repeated.
+type Transforms []transform
+
+// NewTransforms parses comma separated list of transform names, some take argument after colon: "expand-tabs:4".
+func NewTransforms(spec string) (Transforms, error) {
+	var list Transforms
+	if err := list.Set(spec); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (l *Transforms) String() string {
+	if l == nil {
+		return ""
+	}
+	s := make([]string, 0, len(*l))
+	for _, t := range *l {
+		s = append(s, t.name)
+	}
+	return strings.Join(s, ",")
+}
+
+// Set implements flag.Value interface.
+func (l *Transforms) Set(v string) error {
+	for _, spec := range strings.Split(v, ",") {
+		spec = strings.ToLower(strings.TrimSpace(spec))
+		if len(spec) == 0 {
+			continue
+		}
+		name, arg := spec, ""
+		if i := strings.IndexByte(spec, ':'); i >= 0 {
+			name, arg = spec[:i], spec[i+1:]
+		}
+		mk, ok := builtins[name]
+		if !ok {
+			return fmt.Errorf("unknown transform '%s', should be one of %s", name, strings.Join(TransformNames(), ", "))
+		}
+		f, err := mk(arg)
+		if err != nil {
+			return fmt.Errorf("transform '%s': %w", name, err)
+		}
+		*l = append(*l, transform{name: spec, apply: f})
+	}
+	return nil
+}
+
+// Apply runs text through all transforms in order.
+func (l Transforms) Apply(text string) string {
+	for _, t := range l {
+		text = t.apply(text)
+	}
+	return text
+}
+
+// TransformNames lists known transforms.
+func TransformNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// transforms returns chain configured for direction: common transforms, then direction specific ones and line
+// ending conversion last.
+func (c *CLI) transforms(dir Direction) Transforms {
+	chain := append(Transforms{}, c.Transforms...)
+	if dir == DirPaste {
+		chain = append(chain, c.PasteTransforms...)
+	} else {
+		chain = append(chain, c.CopyTransforms...)
+	}
+	if le := strings.ToLower(c.LineEnding); dir != DirSend && (le == "lf" || le == "crlf") {
+		chain = append(chain, transform{name: le, apply: func(text string) string { return ConvertLineEnding(text, le) }})
+	}
+	return chain
+}
+
+// HasTransforms checks if text moving in direction is changed at all.
+func (c *CLI) HasTransforms(dir Direction) bool {
+	return len(c.transforms(dir)) > 0
+}
+
+// Transform applies transforms configured for direction to text.
+func (c *CLI) Transform(dir Direction, text string) string {
+	return c.transforms(dir).Apply(text)
+}
@@ -0,0 +1,106 @@
+package lemon
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransforms(t *testing.T) {
+	assert := func(spec, text, expected string) {
+		t.Helper()
+		l, err := NewTransforms(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := l.Apply(text); got != expected {
+			t.Errorf("'%s' of %q - expected %q, but got %q", spec, text, expected, got)
+		}
+	}
+
+	assert("lf", "a\r\nb\rc\n", "a\nb\nc\n")
+	assert("crlf", "a\nb\r\nc\r", "a\r\nb\r\nc\r\n")
+	assert("crlf", "\n", "\r\n")
+
+	assert("trim-newline", "text\n", "text")
+	assert("trim-newline", "text\r\n\r\n", "text")
+	assert("trim-newline", "\ntext", "\ntext")
+
+	assert("strip-ansi", "\x1b[1;31mred\x1b[0m plain", "red plain")
+	assert("strip-ansi", "\x1b]0;title\x07text\x1b]8;;http://example.com\x1b\\link\x1b]8;;\x1b\\", "textlink")
+	assert("strip-ansi", "\x1b[?25lhidden\x1b[K\x1bM", "hidden")
+	assert("strip-ansi", "no escapes [0m", "no escapes [0m")
+
+	assert("expand-tabs", "\tx", "        x")
+	assert("expand-tabs", "ab\tc\n\td", "ab      c\n        d")
+	assert("expand-tabs:4", "a\tb\tc", "a   b   c")
+	assert("expand-tabs:4", "яя\tb", "яя  b")
+
+	assert("strip-bom", "\ufefftext\ufeff", "text\ufeff")
+	assert("strip-bom", "text", "text")
+
+	assert("remove-nul", "t\x00e\x00xt\x00", "text")
+
+	// transforms are applied in order
+	assert("strip-ansi,trim-newline", "\x1b[32mok\x1b[0m\n", "ok")
+	assert("trim-newline,crlf", "a\nb\n", "a\r\nb")
+	assert("crlf,trim-newline", "a\nb\n", "a\r\nb")
+	assert(" Strip-BOM , , LF ", "\ufeffa\r\n", "a\n")
+	assert("", "text\n", "text\n")
+}
+
+func TestTransformErrors(t *testing.T) {
+	assert := func(spec, expected string) {
+		t.Helper()
+		_, err := NewTransforms(spec)
+		if err == nil {
+			t.Errorf("Expected error for '%s'", spec)
+			return
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error for '%s' to contain '%s', but got '%s'", spec, expected, err.Error())
+		}
+	}
+
+	assert("lf,bogus", "unknown transform 'bogus'")
+	assert("expand-tabs:0", "bad tab width")
+	assert("expand-tabs:x", "bad tab width")
+	assert("lf:1", "unexpected argument")
+}
+
+func TestCLITransform(t *testing.T) {
+
+	c := New()
+	args := []string{"lemonade", "paste", "--transform=strip-ansi", "--transform=strip-bom", "--paste-transform=trim-newline",
+		"--copy-transform=expand-tabs:2", "--line-ending=crlf"}
+	if err := c.ParseFlags(args, true); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.Transforms.String(); s != "strip-ansi,strip-bom" {
+		t.Errorf("Expected transforms flag to be 'strip-ansi,strip-bom', but got '%s'", s)
+	}
+
+	// common transforms, then direction specific ones, line endings are converted last
+	if got := c.Transform(DirPaste, "\ufeff\x1b[1mA\x1b[0m\tb\n"); got != "A\tb" {
+		t.Errorf("Unexpected paste transform result %q", got)
+	}
+	if got := c.Transform(DirCopy, "\x1b[1mA\x1b[0m\tb\n"); got != "A b\r\n" {
+		t.Errorf("Unexpected copy transform result %q", got)
+	}
+	// client leaves line endings of copied text to server
+	if got := c.Transform(DirSend, "\x1b[1mA\x1b[0m\tb\n"); got != "A b\n" {
+		t.Errorf("Unexpected send transform result %q", got)
+	}
+
+	c = New()
+	c.LineEnding = "crlf"
+	if c.HasTransforms(DirSend) {
+		t.Errorf("Expected no transforms of sent text unless they are given explicitly")
+	}
+	c = New()
+	if c.HasTransforms(DirCopy) || c.HasTransforms(DirPaste) || c.HasTransforms(DirSend) {
+		t.Errorf("Expected no transforms by default")
+	}
+	if err := c.ParseFlags([]string{"lemonade", "paste", "--transform=nothing"}, true); err == nil {
+		t.Errorf("Expected error for unknown transform")
+	}
+}
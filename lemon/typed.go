@@ -0,0 +1,181 @@
+package lemon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+// Errors reported by typed clipboard implementations.
+var (
+	ErrTypedUnsupported = errors.New("typed clipboard content is not supported on this platform")
+	ErrTypeUnavailable  = errors.New("clipboard content of requested type is not available")
+)
+
+// IsText checks if MIME type denotes plain text, which is always handled as a string.
+func IsText(mime string) bool {
+	return len(mime) == 0 || strings.HasPrefix(strings.ToLower(mime), "text/plain")
+}
+
+// runTool executes clipboard helper program and returns its output.
+func runTool(name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); len(msg) > 0 {
+			return nil, fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return out, nil
+}
+
+// feedTool executes clipboard helper program feeding it input. Output is never captured - some helpers stay in
+// background serving clipboard requests and would keep pipes open.
+func feedTool(input []byte, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// CopyTyped is implementation of "lemonade" rpc "copy" command for typed content.
+func (c *Clipboard) CopyTyped(p *param.CopyTypedParam, _ *struct{}) error {
+	if err := c.svc.checkRate(c.peer); err != nil {
+		return err
+	}
+	size := 0
+	for _, f := range p.Formats {
+		size += len(f.Data)
+	}
+	if err := checkSize("copied content", size, c.cli.MaxCopySize); err != nil {
+		log.Printf("lemonade CopyTyped request from '%s' rejected: %s", c.peer, err.Error())
+		return err
+	}
+
+	if err := c.svc.checkSelection(p.Selection); err != nil {
+		return err
+	}
+
+	if c.cli.Debug {
+		log.Printf("lemonade CopyTyped request from '%s' received %d formats, %d bytes, selection '%s'", c.peer, len(p.Formats), size, p.Selection)
+	}
+
+	return c.copyFormats("CopyTyped", p.Selection, author{origin: p.Origin, host: p.Host, user: p.User}, p.Formats)
+}
+
+// PasteTyped is implementation of "lemonade" rpc "paste" command for typed content.
+func (c *Clipboard) PasteTyped(p *param.PasteTypedParam, resp *param.ClipboardFormat) error {
+	if err := c.svc.checkRate(c.peer); err != nil {
+		return err
+	}
+	if err := c.svc.checkSelection(p.Selection); err != nil {
+		return err
+	}
+	if c.cli.Debug {
+		log.Printf("lemonade PasteTyped request from '%s' for %v, selection '%s'", c.peer, p.Types, p.Selection)
+	}
+
+	f, err := c.pasteFormat("PasteTyped", p.Selection, p.Types)
+	if err != nil {
+		return err
+	}
+	if f.Data, f.Compression, err = Compress(f.Data, p.Compression, c.cli.CompressThreshold, c.cli.Debug); err != nil {
+		return err
+	}
+	*resp = f
+	return nil
+}
+
+// copyFormats sets selection to alternative formats of content, decompressing them and transforming text.
+func (c *Clipboard) copyFormats(name, sel string, by author, fs []param.ClipboardFormat) error {
+	if len(fs) == 0 {
+		return errors.New("nothing to copy")
+	}
+
+	var (
+		text      string
+		sensitive bool
+		total     int
+		err       error
+		limit     = c.uploadLimit()
+		formats   = make([]param.ClipboardFormat, 0, len(fs))
+	)
+	for _, f := range fs {
+		if f.Data, err = Decompress(f.Data, f.Compression, limit, c.cli.Debug); err != nil {
+			return fmt.Errorf("unable to copy %s: %w", f.MIME, err)
+		}
+		f.Compression = ""
+		total += len(f.Data)
+		if err := checkSize("copied content", total, limit); err != nil {
+			return err
+		}
+		if IsText(f.MIME) {
+			if text, sensitive, err = c.svc.applyPolicy(name, c.peer, c.cli.Transform(DirCopy, string(f.Data))); err != nil {
+				return err
+			}
+			f.Data = []byte(text)
+		}
+		formats = append(formats, f)
+	}
+
+	var kept []param.ClipboardFormat
+	if _, err := c.svc.call(name, c.peer, func() (string, error) {
+		var err error
+		kept, err = c.svc.writeFormats(sel, formats)
+		return "", err
+	}); err != nil {
+		return fmt.Errorf("unable to copy: %w", err)
+	}
+	for _, f := range kept {
+		if IsText(f.MIME) {
+			c.svc.changed(string(f.Data), peerSource(c.peer), by.origin)
+			if sensitive {
+				c.svc.clearSensitive(sel, string(f.Data))
+			}
+			break
+		}
+	}
+	if strings.ToLower(sel) != param.SelectionPrimary {
+		c.recordCopy(kept[0].MIME, kept[0].Data, by)
+	}
+	if c.cli.Debug {
+		log.Printf("lemonade %s set clipboard to '%s'", name, kept[0].MIME)
+	}
+	return nil
+}
+
+// pasteFormat gets selection content of the first available type.
+func (c *Clipboard) pasteFormat(name, sel string, types []string) (param.ClipboardFormat, error) {
+	var errs []string
+	for _, mime := range types {
+		mime := mime
+		data, err := c.svc.call(name, c.peer, func() (string, error) {
+			b, err := c.svc.readFormat(sel, mime)
+			return string(b), err
+		})
+		if err == nil && IsText(mime) {
+			if data, _, err = c.svc.applyPolicy(name, c.peer, data); err != nil {
+				return param.ClipboardFormat{}, err
+			}
+			mime = param.MIMEText
+		}
+		if err == nil {
+			return param.ClipboardFormat{MIME: mime, Data: []byte(data)}, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", mime, err.Error()))
+	}
+	if len(errs) == 0 {
+		return param.ClipboardFormat{}, errors.New("no content types requested")
+	}
+	return param.ClipboardFormat{}, fmt.Errorf("unable to paste: %s", strings.Join(errs, "; "))
+}
@@ -0,0 +1,84 @@
+package lemon
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+// Typed content is handled by AppleScript, which knows clipboard data by class rather than MIME type.
+var appleClasses = map[string]string{
+	"image/png":       "PNGf",
+	"image/tiff":      "TIFF",
+	"image/jpeg":      "JPEG",
+	"text/html":       "HTML",
+	"text/rtf":        "RTF ",
+	"application/rtf": "RTF ",
+	"application/pdf": "PDF ",
+}
+
+var appleDataRe = regexp.MustCompile(`(?s)^«data [A-Za-z ]{4}([0-9A-Fa-f]*)»\s*$`)
+
+func appleClass(mime string) (string, error) {
+	class, ok := appleClasses[strings.ToLower(mime)]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown content type '%s'", ErrTypedUnsupported, mime)
+	}
+	return class, nil
+}
+
+// systemTypedBackend is system backend keeping typed content.
+type systemTypedBackend struct {
+	systemBackend
+}
+
+// There is no PRIMARY selection on this platform.
+func newSystemBackend() ClipboardBackend {
+	return systemTypedBackend{}
+}
+
+func (systemTypedBackend) ReadTyped(mime string) ([]byte, error) {
+
+	class, err := appleClass(mime)
+	if err != nil {
+		return nil, err
+	}
+	out, err := runTool("osascript", "-e", fmt.Sprintf("the clipboard as «class %s»", class))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrTypeUnavailable, err.Error())
+	}
+	m := appleDataRe.FindSubmatch(out)
+	if m == nil {
+		return nil, ErrTypeUnavailable
+	}
+	return hex.DecodeString(string(m[1]))
+}
+
+func (systemTypedBackend) WriteTyped(f param.ClipboardFormat) error {
+
+	class, err := appleClass(f.MIME)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile("", "lemonade-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(f.Data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	_, err = runTool("osascript", "-e", fmt.Sprintf(`set the clipboard to (read (POSIX file %q) as «class %s»)`, tmp.Name(), class))
+	return err
+}
@@ -0,0 +1,143 @@
+//go:build linux || freebsd || netbsd || openbsd || dragonfly
+// +build linux freebsd netbsd openbsd dragonfly
+
+package lemon
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+// Typed content and PRIMARY selection are handled by the same external tools atotto/clipboard is using for text,
+// termux does not support either, xsel supports PRIMARY selection for text only.
+
+func hasTool(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+func useWayland() bool {
+	return len(os.Getenv("WAYLAND_DISPLAY")) > 0 && hasTool("wl-copy") && hasTool("wl-paste")
+}
+
+func errNoTool() error {
+	return fmt.Errorf("%w: install xclip or wl-clipboard", ErrTypedUnsupported)
+}
+
+func errNoSelectionTool() error {
+	return fmt.Errorf("%w: install xclip, xsel or wl-clipboard", ErrSelectionUnsupported)
+}
+
+func availableTypes(sel string) ([]string, error) {
+	var (
+		out []byte
+		err error
+	)
+	switch {
+	case useWayland():
+		out, err = runTool("wl-paste", waylandArgs(sel, "--list-types")...)
+	case hasTool("xclip"):
+		out, err = runTool("xclip", "-selection", sel, "-t", "TARGETS", "-o")
+	default:
+		return nil, errNoTool()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+func waylandArgs(sel string, args ...string) []string {
+	if sel == param.SelectionPrimary {
+		return append([]string{"--primary"}, args...)
+	}
+	return args
+}
+
+// readSelection gets content of requested type from selection, empty type means text.
+func readSelection(sel, mime string) ([]byte, error) {
+
+	if len(mime) == 0 {
+		switch {
+		case useWayland():
+			return runTool("wl-paste", waylandArgs(sel, "--no-newline")...)
+		case hasTool("xclip"):
+			return runTool("xclip", "-selection", sel, "-o")
+		case hasTool("xsel"):
+			return runTool("xsel", "--"+sel, "--output")
+		default:
+			return nil, errNoSelectionTool()
+		}
+	}
+
+	types, err := availableTypes(sel)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, t := range types {
+		if strings.EqualFold(t, mime) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, ErrTypeUnavailable
+	}
+
+	if useWayland() {
+		return runTool("wl-paste", waylandArgs(sel, "--no-newline", "--type", mime)...)
+	}
+	return runTool("xclip", "-selection", sel, "-t", mime, "-o")
+}
+
+// writeSelection sets selection content, empty type means text.
+func writeSelection(sel string, f param.ClipboardFormat) error {
+	switch {
+	case useWayland():
+		if len(f.MIME) == 0 {
+			return feedTool(f.Data, "wl-copy", waylandArgs(sel)...)
+		}
+		return feedTool(f.Data, "wl-copy", waylandArgs(sel, "--type", f.MIME)...)
+	case hasTool("xclip"):
+		if len(f.MIME) == 0 {
+			return feedTool(f.Data, "xclip", "-selection", sel, "-i")
+		}
+		return feedTool(f.Data, "xclip", "-selection", sel, "-t", f.MIME, "-i")
+	case hasTool("xsel") && len(f.MIME) == 0:
+		return feedTool(f.Data, "xsel", "--"+sel, "--input")
+	case len(f.MIME) == 0:
+		return errNoSelectionTool()
+	default:
+		return errNoTool()
+	}
+}
+
+// systemPrimaryBackend is system backend on platforms with PRIMARY selection.
+type systemPrimaryBackend struct {
+	systemBackend
+}
+
+func newSystemBackend() ClipboardBackend {
+	return systemPrimaryBackend{}
+}
+
+func (systemPrimaryBackend) ReadTyped(mime string) ([]byte, error) {
+	return readSelection(param.SelectionClipboard, mime)
+}
+
+func (systemPrimaryBackend) WriteTyped(f param.ClipboardFormat) error {
+	return writeSelection(param.SelectionClipboard, f)
+}
+
+func (systemPrimaryBackend) ReadPrimary(mime string) ([]byte, error) {
+	return readSelection(param.SelectionPrimary, mime)
+}
+
+func (systemPrimaryBackend) WritePrimary(f param.ClipboardFormat) error {
+	return writeSelection(param.SelectionPrimary, f)
+}
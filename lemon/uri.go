@@ -11,33 +11,49 @@ import (
 	"github.com/rupor-github/lemonade/param"
 )
 
+// Replaceable for testing.
+var openURI = open.Run
+
 // URI is used by "lemonade" to rpc open commands.
 type URI struct {
-	cli *CLI
+	cli  *CLI
+	svc  *Service
+	peer net.Addr
 }
 
-// NewURI initializes URI structure.
-func NewURI(c *CLI) *URI {
+// NewURI initializes URI structure for connection with peer.
+func NewURI(s *Service, peer net.Addr) *URI {
 	return &URI{
-		cli: c,
+		cli:  s.cli,
+		svc:  s,
+		peer: peer,
 	}
 }
 
 // Open is implementation of "lemonade" rpc "open" command.
 func (u *URI) Open(param *param.OpenParam, _ *struct{}) error {
+	if err := u.svc.checkRate(u.peer); err != nil {
+		return err
+	}
+	if err := checkSize("URI", len(param.URI), u.cli.MaxURISize); err != nil {
+		log.Printf("lemonade URI request from '%s' rejected: %s", u.peer, err.Error())
+		return err
+	}
 
-	conn := <-u.cli.ConnCh
 	if u.cli.Debug {
-		log.Printf("lemonade URI parameters received: '%v'", *param)
+		log.Printf("lemonade URI parameters received from '%s': '%v'", u.peer, *param)
 	}
 	uri := param.URI
 	if param.TransLoopback {
-		uri = translateLoopbackIP(param.URI, conn)
+		uri = translateLoopbackIP(param.URI, u.peer)
 	}
 	if u.cli.Debug {
 		log.Printf("lemonade run URI: '%s'", uri)
 	}
-	return open.Run(uri)
+	_, err := u.svc.call("Open", u.peer, func() (string, error) {
+		return "", u.svc.openURI(uri)
+	})
+	return err
 }
 
 func removeIPv6Brackets(ip string) string {
@@ -58,7 +74,7 @@ func splitHostPort(hostPort string) []string {
 	return []string{removeIPv6Brackets(host), port}
 }
 
-func translateLoopbackIP(uri string, conn net.Conn) string {
+func translateLoopbackIP(uri string, peer net.Addr) string {
 
 	parsed, err := url.Parse(uri)
 	if err != nil {
@@ -77,7 +93,13 @@ func translateLoopbackIP(uri string, conn net.Conn) string {
 		return uri
 	}
 
-	addr := conn.RemoteAddr().(*net.TCPAddr).IP.String()
+	// there is nothing to translate to for non TCP peers (unix sockets)
+	tcpAddr, ok := peer.(*net.TCPAddr)
+	if !ok {
+		return uri
+	}
+
+	addr := tcpAddr.IP.String()
 	if len(parts) == 1 {
 		parsed.Host = addr
 	} else {
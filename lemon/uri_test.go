@@ -22,7 +22,7 @@ func TestSplitHostPort(t *testing.T) {
 }
 
 type ConnMock struct {
-	addr *net.TCPAddr
+	addr net.Addr
 }
 
 func (*ConnMock) Read([]byte) (int, error)         { return 0, nil }
@@ -38,7 +38,7 @@ var _ net.Conn = &ConnMock{}
 
 func TestURItranslateLoopbackIP(t *testing.T) {
 	assert := func(uri string, conn net.Conn, expected string) {
-		got := translateLoopbackIP(uri, conn)
+		got := translateLoopbackIP(uri, conn.RemoteAddr())
 		if got != expected {
 			t.Errorf("Expected: %s, but got %s", expected, got)
 		}
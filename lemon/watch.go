@@ -0,0 +1,174 @@
+package lemon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+const defaultWatchTimeout = 30 * time.Second
+
+// watchState tracks clipboard text observed by server, so clients could wait for it to change.
+type watchState struct {
+	mu      sync.Mutex
+	hash    string // empty until clipboard is observed for the first time
+	text    string
+	origin  string
+	changed chan struct{} // closed and replaced on every change
+	once    sync.Once
+	stop    chan struct{}
+}
+
+func newWatchState() *watchState {
+	return &watchState{
+		changed: make(chan struct{}),
+		stop:    make(chan struct{}),
+	}
+}
+
+// HashText returns hash used to identify clipboard text.
+func HashText(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func (w *watchState) current() (string, string, <-chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.hash, w.text, w.changed
+}
+
+// changed records new clipboard text set by source, keeping it in history and waking up watching clients. Origin is
+// an opaque tag set by client which made the change, if any.
+func (s *Service) changed(text, source, origin string) {
+	hash := HashText(text)
+
+	w := s.watch
+	w.mu.Lock()
+	if hash == w.hash {
+		w.mu.Unlock()
+		return
+	}
+	w.hash, w.text, w.origin = hash, text, origin
+	close(w.changed)
+	w.changed = make(chan struct{})
+	w.mu.Unlock()
+
+	if source == historyLocal {
+		s.recordLocal(text)
+	}
+	if s.history == nil {
+		return
+	}
+	if kept, ok := s.keptText(text); ok && s.history.add(kept, source, time.Now()) && s.cli.Debug {
+		log.Printf("lemonade history keeps %d bytes from '%s'", len(kept), source)
+	}
+}
+
+// StartMonitor starts polling clipboard for changes made locally, it is safe to call it more than once.
+func (s *Service) StartMonitor() {
+	if s.cli.ClipboardPoll <= 0 {
+		return
+	}
+	s.watch.once.Do(func() { go s.monitor() })
+}
+
+// Close stops clipboard monitor.
+func (s *Service) Close() {
+	select {
+	case <-s.watch.stop:
+	default:
+		close(s.watch.stop)
+	}
+}
+
+func (s *Service) monitor() {
+
+	if s.cli.Debug {
+		log.Printf("lemonade checking clipboard for changes every %s", s.cli.ClipboardPoll)
+	}
+
+	ticker := time.NewTicker(s.cli.ClipboardPoll)
+	defer ticker.Stop()
+
+	for {
+		text, err := s.backend.ReadAll()
+		if err != nil {
+			if s.cli.Debug {
+				log.Printf("lemonade unable to read clipboard: %s", err.Error())
+			}
+		} else {
+			s.changed(text, historyLocal, "")
+		}
+		select {
+		case <-s.watch.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchTimeout limits time call could wait for changes, so connection is not considered idle by server.
+func (s *Service) watchTimeout(requested time.Duration) time.Duration {
+	timeout := defaultWatchTimeout
+	if requested > 0 && requested < timeout {
+		timeout = requested
+	}
+	if idle := s.cli.IdleTimeout / 2; idle > 0 && idle < timeout {
+		timeout = idle
+	}
+	return timeout
+}
+
+// Watch is implementation of "lemonade" rpc "paste --watch" command: it waits for clipboard text to change.
+func (c *Clipboard) Watch(p *param.WatchParam, resp *param.WatchResult) error {
+	if err := c.svc.checkRate(c.peer); err != nil {
+		return err
+	}
+	c.svc.StartMonitor()
+
+	hash, _, changed := c.svc.watch.current()
+	if len(hash) == 0 {
+		// nothing observed yet
+		text, err := c.svc.call("Watch", c.peer, c.svc.backend.ReadAll)
+		if err != nil {
+			return err
+		}
+		c.svc.changed(text, historyLocal, "")
+		hash, _, changed = c.svc.watch.current()
+	}
+
+	if hash == p.Hash {
+		timeout := c.svc.watchTimeout(p.Timeout)
+		if c.cli.Debug {
+			log.Printf("lemonade Watch request from '%s' waiting up to %s", c.peer, timeout)
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-c.svc.watch.stop:
+		}
+	}
+
+	w := c.svc.watch
+	w.mu.Lock()
+	*resp = param.WatchResult{Changed: w.hash != p.Hash, Hash: w.hash, Origin: w.origin}
+	text := w.text
+	w.mu.Unlock()
+	if resp.Changed && !p.HashOnly {
+		var err error
+		if resp.Text, _, err = c.svc.applyPolicy("Watch", c.peer, text); err != nil {
+			return err
+		}
+	}
+	if c.cli.Debug {
+		log.Printf("lemonade Watch request from '%s' changed: %v, len: %d", c.peer, resp.Changed, len(resp.Text))
+	}
+	return nil
+}
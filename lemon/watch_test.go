@@ -0,0 +1,124 @@
+package lemon
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rupor-github/lemonade/param"
+)
+
+func TestServiceWatch(t *testing.T) {
+
+	m := newMemClipboard()
+	if err := m.WriteAll("initial"); err != nil {
+		t.Fatal(err)
+	}
+	c := New()
+	c.ClipboardPoll = time.Millisecond
+	svc := NewService(c, m)
+	defer svc.Close()
+
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	watch := func(p *param.WatchParam) *param.WatchResult {
+		t.Helper()
+		var resp param.WatchResult
+		if err := rc.Call("Clipboard.Watch", p, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return &resp
+	}
+
+	// current content is returned immediately
+	res := watch(&param.WatchParam{})
+	if !res.Changed || res.Text != "initial" || res.Hash != HashText("initial") {
+		t.Fatalf("Unexpected result: %+v", res)
+	}
+
+	// nothing changes
+	start := time.Now()
+	if r := watch(&param.WatchParam{Hash: res.Hash, Timeout: 20 * time.Millisecond}); r.Changed || r.Hash != res.Hash {
+		t.Errorf("Unexpected result: %+v", r)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Errorf("Expected call to wait for timeout")
+	}
+
+	// changes made by other clients are reported
+	done := make(chan *param.WatchResult)
+	go func() {
+		var resp param.WatchResult
+		err := rc.Call("Clipboard.Watch", &param.WatchParam{Hash: res.Hash, Timeout: 10 * time.Second}, &resp)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- &resp
+	}()
+	other := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.2")})
+	defer other.Close()
+	time.Sleep(10 * time.Millisecond)
+	if err := other.Call("Clipboard.Copy", "copied", dummy); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-done; !r.Changed || r.Text != "copied" {
+		t.Errorf("Unexpected result: %+v", r)
+	}
+
+	// as well as local ones
+	if err := m.WriteAll("local"); err != nil {
+		t.Fatal(err)
+	}
+	if r := watch(&param.WatchParam{Hash: HashText("copied"), HashOnly: true, Timeout: 10 * time.Second}); !r.Changed || r.Hash != HashText("local") || len(r.Text) != 0 {
+		t.Errorf("Unexpected result: %+v", r)
+	}
+}
+
+func TestWatchTimeout(t *testing.T) {
+	c := New()
+	c.IdleTimeout = 10 * time.Second
+	svc := NewService(c, newMemoryBackend())
+
+	if got := svc.watchTimeout(0); got != 5*time.Second {
+		t.Errorf("Expected timeout below idle timeout, but got %s", got)
+	}
+	if got := svc.watchTimeout(time.Second); got != time.Second {
+		t.Errorf("Expected requested timeout, but got %s", got)
+	}
+	c.IdleTimeout = 0
+	if got := svc.watchTimeout(time.Hour); got != defaultWatchTimeout {
+		t.Errorf("Expected default timeout, but got %s", got)
+	}
+}
+
+func TestServiceWatchOrigin(t *testing.T) {
+
+	m := newMemClipboard()
+	svc := NewService(New(), m)
+	rc := dialService(t, svc, &net.TCPAddr{IP: net.ParseIP("192.168.0.1")})
+	defer rc.Close()
+
+	p := &param.CopyTypedParam{Formats: []param.ClipboardFormat{{Data: []byte("text")}}, Origin: "box"}
+	if err := rc.Call("Clipboard.CopyTyped", p, dummy); err != nil {
+		t.Fatal(err)
+	}
+	var resp param.WatchResult
+	if err := rc.Call("Clipboard.Watch", &param.WatchParam{}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Changed || resp.Origin != "box" || resp.Text != "text" {
+		t.Errorf("Unexpected result: %+v", resp)
+	}
+
+	if err := rc.Call("Clipboard.Copy", "other", dummy); err != nil {
+		t.Fatal(err)
+	}
+	var next param.WatchResult
+	if err := rc.Call("Clipboard.Watch", &param.WatchParam{Hash: resp.Hash}, &next); err != nil {
+		t.Fatal(err)
+	}
+	if !next.Changed || len(next.Origin) != 0 || next.Text != "other" {
+		t.Errorf("Unexpected result: %+v", next)
+	}
+}
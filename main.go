@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -21,6 +22,7 @@ const (
 	exitFlagParseError
 	exitRPCError
 	exitHelp
+	exitAuthError
 )
 
 // os.Exit() prevents defers from proper cleanup.
@@ -45,17 +47,38 @@ func run() int {
 	case lemon.CmdCopy:
 		err = client.Copy(cli)
 	case lemon.CmdPaste:
-		var text string
-		text, err = client.Paste(cli)
-		os.Stdout.Write([]byte(text))
+		if cli.Watch {
+			err = client.Watch(cli)
+			break
+		}
+		if len(cli.Output) > 0 {
+			err = client.PasteFile(cli)
+			break
+		}
+		err = client.Paste(cli, os.Stdout)
 	case lemon.CmdServer:
 		err = server.Serve(cli)
+	case lemon.CmdVersion:
+		err = client.Version(cli)
+	case lemon.CmdSync:
+		err = client.Sync(cli)
+	case lemon.CmdHistory:
+		var text string
+		text, err = client.History(cli)
+		os.Stdout.Write([]byte(text))
+	case lemon.CmdStat:
+		var text string
+		text, err = client.Stat(cli)
+		os.Stdout.Write([]byte(text))
 	default:
 		panic("Unreachable code")
 	}
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "\n\n*** ERROR: %s\n", err.Error())
+		if errors.Is(err, lemon.ErrAuth) {
+			return exitAuthError
+		}
 		return exitRPCError
 	}
 	return exitSuccess
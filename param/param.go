@@ -1,7 +1,148 @@
 package param
 
+import "time"
+
+// ProtocolVersion is incremented every time rpc interface is extended. Servers without "Server.Info" are version 0.
+const ProtocolVersion = 8
+
+// Capabilities advertised by server.
+const (
+	CapJSONRPC   = "jsonrpc"
+	CapHTTP      = "http"
+	CapTyped     = "typed"     // since protocol version 2
+	CapHistory   = "history"   // since protocol version 3
+	CapSelection = "selection" // since protocol version 4
+	CapWatch     = "watch"     // since protocol version 5
+	CapChunked   = "chunked"   // since protocol version 6
+	CapCompress  = "compress"  // since protocol version 7
+	CapStat      = "stat"      // since protocol version 8
+)
+
+// MIMEText is type of plain text clipboard content.
+const MIMEText = "text/plain;charset=utf-8"
+
+// Compression methods, content smaller than threshold is always sent as is.
+const (
+	CompressionNone  = "none"
+	CompressionGzip  = "gzip"
+	CompressionFlate = "flate"
+)
+
+// Selections clipboard content could be exchanged with, empty selection is the same as SelectionClipboard.
+const (
+	SelectionClipboard = "clipboard"
+	SelectionPrimary   = "primary" // X11 PRIMARY selection
+	SelectionBoth      = "both"    // copy sets both, paste prefers clipboard falling back to primary when it is empty
+)
+
 // OpenParam is used in "open" RPC call.
 type OpenParam struct {
 	URI           string
 	TransLoopback bool
 }
+
+// ClipboardFormat is a single representation of clipboard content.
+type ClipboardFormat struct {
+	MIME        string
+	Data        []byte
+	Compression string // method Data is compressed with, empty if it is not
+}
+
+// CopyTypedParam is used in "Clipboard.CopyTyped" RPC call. Formats are alternative representations of the same
+// content in order of preference. Server backends keeping content in memory hold all of them, system clipboard
+// helper tools (xclip, wl-copy, osascript) hold one type at a time, so the first format they accept wins.
+type CopyTypedParam struct {
+	Formats   []ClipboardFormat
+	Selection string
+	Origin    string // opaque tag of the client making change, reported back by "Clipboard.Watch"
+	Host      string // host name of the client making change as reported by it, since protocol version 8
+	User      string // user name of the client making change as reported by it, since protocol version 8
+}
+
+// PasteTypedParam is used in "Clipboard.PasteTyped" RPC call. Types are acceptable MIME types in order of preference.
+type PasteTypedParam struct {
+	Types       []string
+	Selection   string
+	Compression string // method client is able to decompress returned content with, empty if none
+}
+
+// HistoryEntry is returned by "History.List" (without Text) and "History.Get" RPC calls. Index 0 is the most recent entry.
+type HistoryEntry struct {
+	Index   int
+	Time    time.Time
+	Size    int
+	Source  string // remote host which copied text or "local" for changes observed on server clipboard
+	Preview string
+	Text    string
+}
+
+// WatchParam is used in "Clipboard.Watch" RPC call. Call returns as soon as clipboard text hash differs from Hash
+// (immediately if Hash is empty) or when Timeout passes. Server may use shorter timeout than requested.
+type WatchParam struct {
+	Hash     string
+	HashOnly bool // do not send clipboard text back
+	Timeout  time.Duration
+}
+
+// WatchResult is returned by "Clipboard.Watch" RPC call.
+type WatchResult struct {
+	Changed bool
+	Hash    string // sha256 of clipboard text, hex encoded
+	Text    string
+	Origin  string // tag of the client which made the change, if any
+}
+
+// TransferParam is used in "Clipboard.CopyBegin" RPC call to start chunked upload, which is followed by
+// "Clipboard.CopyChunk" calls and finished by "Clipboard.CopyEnd" call with sha256 of content, hex encoded. When
+// chunks are compressed checksum is of decompressed content.
+type TransferParam struct {
+	MIME        string
+	Selection   string
+	Origin      string
+	Size        int    // expected size if known, -1 otherwise
+	Compression string // method chunks are compressed with, empty if they are not
+	Host        string // host name of the client making change as reported by it, since protocol version 8
+	User        string // user name of the client making change as reported by it, since protocol version 8
+}
+
+// TransferInfo is returned by "Clipboard.PasteBegin" RPC call starting chunked download, content is received by
+// "Clipboard.PasteChunk" calls until empty chunk is returned.
+type TransferInfo struct {
+	MIME        string
+	Size        int    // number of bytes to be transferred
+	Hash        string // sha256 of content, hex encoded
+	Compression string // method transferred bytes are compressed with, empty if they are not
+}
+
+// ClipboardStat is returned by "Clipboard.Stat" RPC call, it describes the last clipboard change server knows of.
+type ClipboardStat struct {
+	Source string    `json:"source"`         // remote host which set clipboard or "local" for changes made on server desktop
+	Host   string    `json:"host,omitempty"` // host name reported by remote client, if any
+	User   string    `json:"user,omitempty"` // user name reported by remote client, if any
+	Time   time.Time `json:"time"`
+	Size   int       `json:"bytes"`
+	Lines  int       `json:"lines"` // 0 for content which is not text
+	MIME   string    `json:"mime"`
+	Hash   string    `json:"hash"` // sha256 of content, hex encoded
+}
+
+// InfoResult is returned by "Server.Info" RPC call.
+type InfoResult struct {
+	Version         string
+	OS              string
+	Arch            string
+	ProtocolVersion int
+	Capabilities    []string
+	LineEnding      string // line endings server converts copied text to
+	MaxPayload      int    // 0 if unlimited
+}
+
+// Has checks if server advertised capability.
+func (i *InfoResult) Has(capability string) bool {
+	for _, c := range i.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
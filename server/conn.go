@@ -0,0 +1,104 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// limitListener caps number of concurrently open connections. When limit is reached it stops accepting
+// and new connections wait in listen backlog.
+type limitListener struct {
+	net.Listener
+	sem   chan struct{}
+	debug bool
+}
+
+func newLimitListener(l net.Listener, sem chan struct{}, debug bool) net.Listener {
+	return &limitListener{Listener: l, sem: sem, debug: debug}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	default:
+		if l.debug {
+			log.Printf("lemonade server reached limit of %d connections, waiting", cap(l.sem))
+		}
+		l.sem <- struct{}{}
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: func() { <-l.sem }}, nil
+}
+
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// idleConn closes connection when it is idle for too long: client sends nothing and no call is being executed. Rpc
+// server keeps reading next request while calls are executed, so deadline of that read is lifted until the last
+// running call is answered.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+	debug   bool
+	mu      sync.Mutex
+	calls   int
+}
+
+func newIdleConn(conn net.Conn, timeout time.Duration, debug bool) net.Conn {
+	if timeout <= 0 {
+		return conn
+	}
+	return &idleConn{Conn: conn, timeout: timeout, debug: debug}
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	if c.calls == 0 {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+	c.mu.Unlock()
+	n, err := c.Conn.Read(p)
+	var ne net.Error
+	if err != nil && c.debug && errors.As(err, &ne) && ne.Timeout() {
+		log.Printf("lemonade server closing '%s' after being idle for %s", c.RemoteAddr(), c.timeout)
+	}
+	return n, err
+}
+
+// CallStarted pauses idle timeout.
+func (c *idleConn) CallStarted() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	if c.calls == 1 {
+		_ = c.Conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// CallFinished restarts idle timeout when the last running call is answered.
+func (c *idleConn) CallFinished() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls > 0 {
+		c.calls--
+	}
+	if c.calls == 0 {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+
+	"github.com/rupor-github/lemonade/lemon"
+)
+
+// slowClipboard takes its time reading clipboard.
+type slowClipboard struct {
+	delay time.Duration
+	text  string
+}
+
+func (b *slowClipboard) ReadAll() (string, error) {
+	time.Sleep(b.delay)
+	return b.text, nil
+}
+
+func (b *slowClipboard) WriteAll(text string) error {
+	b.text = text
+	return nil
+}
+
+func TestLimitListener(t *testing.T) {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newLimitListener(ln, make(chan struct{}, 1), false)
+	defer l.Close()
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+	}
+
+	first, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+		t.Fatal("Expected second connection to wait while limit is reached")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// closing connection lets the next one in, closing it again does not free more
+	first.Close()
+	first.Close()
+	select {
+	case conn := <-accepted:
+		defer conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected second connection to be accepted after the first one was closed")
+	}
+	if n := len(l.(*limitListener).sem); n != 1 {
+		t.Errorf("Expected single connection to be counted, but got %d", n)
+	}
+}
+
+func TestIdleConn(t *testing.T) {
+
+	const timeout = 100 * time.Millisecond
+
+	b := &slowClipboard{delay: 3 * timeout, text: "text"}
+	svc := lemon.NewService(lemon.New(), b)
+	sc, cc := net.Pipe()
+	go func() { _ = svc.ServeConn(newIdleConn(sc, timeout, false), lemon.CodecGob) }()
+	rc := rpc.NewClient(cc)
+	defer rc.Close()
+
+	// call running longer than idle timeout is answered
+	var text string
+	if err := rc.Call("Clipboard.Paste", struct{}{}, &text); err != nil || text != "text" {
+		t.Fatalf("Expected slow call to be answered, but got '%s' '%v'", text, err)
+	}
+
+	// reply restarts idle timeout, so connection stays usable for a while after it
+	b.delay = 0
+	for i := 0; i < 3; i++ {
+		time.Sleep(timeout / 2)
+		if err := rc.Call("Clipboard.Paste", struct{}{}, &text); err != nil {
+			t.Fatalf("Expected connection to be open, but got '%v'", err)
+		}
+	}
+
+	// and closed when nothing happens
+	time.Sleep(3 * timeout)
+	if err := rc.Call("Clipboard.Paste", struct{}{}, &text); err == nil {
+		t.Errorf("Expected idle connection to be closed")
+	}
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+
+	"github.com/rupor-github/lemonade/lemon"
+	"github.com/rupor-github/lemonade/misc"
+	"github.com/rupor-github/lemonade/param"
+)
+
+// HTTP API mirrors rpc calls:
+//
+//	GET  /health            - server status, never requires authentication
+//	GET  /challenge         - nonce to authenticate next request with when secret is used
+//	GET  /clipboard         - clipboard content, optional "line-ending" query parameter (LF/CRLF)
+//	PUT  /clipboard         - set clipboard content to request body
+//	POST /open              - open URI, JSON body mirrors param.OpenParam
+//
+// When server has secret requests must carry "Authorization: Lemonade <nonce>:<hex HMAC-SHA256(secret, "client" + nonce bytes)>"
+// header answering challenge obtained from /challenge, for example:
+//
+//	n=$(curl -s http://host:port/challenge)
+//	m=$(echo -n "client$(echo -n $n | xxd -r -p)" | openssl dgst -sha256 -hmac "$LEMONADE_SECRET" -r | cut -d' ' -f1)
+//	curl -s -H "Authorization: Lemonade $n:$m" http://host:port/clipboard
+
+const authScheme = "Lemonade "
+
+var dummy = &struct{}{}
+
+// handler routes HTTP API requests.
+func (s *server) handler() http.Handler {
+	m := http.NewServeMux()
+	m.HandleFunc("/health", s.handleHealth)
+	m.HandleFunc("/challenge", s.handleChallenge)
+	m.HandleFunc("/clipboard", s.guard(s.handleClipboard))
+	m.HandleFunc("/open", s.guard(s.handleOpen))
+	return m
+}
+
+func (s *server) serveHTTP(l net.Listener) error {
+
+	// whole request has to be read in time, so body could not be trickled forever
+	readTimeout := s.cli.HandshakeTimeout
+	if s.cli.IdleTimeout > readTimeout {
+		readTimeout = s.cli.IdleTimeout
+	}
+	srv := &http.Server{
+		Handler:           s.handler(),
+		ReadHeaderTimeout: s.cli.HandshakeTimeout,
+		ReadTimeout:       readTimeout,
+		IdleTimeout:       s.cli.IdleTimeout,
+	}
+	if err := srv.Serve(l); err != nil {
+		return fmt.Errorf("lemonade HTTP server error: '%w'", err)
+	}
+	return nil
+}
+
+// peer returns remote address of HTTP client.
+func peer(r *http.Request) *net.TCPAddr {
+	addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	return addr
+}
+
+// status maps errors returned by services to HTTP status codes.
+func status(err error) int {
+	switch {
+	case errors.Is(err, lemon.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, lemon.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, lemon.ErrPolicy), errors.Is(err, lemon.ErrOpenDisabled):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// allowed applies the same allow list as for rpc connections.
+func (s *server) allowed(w http.ResponseWriter, r *http.Request) bool {
+	p := peer(r)
+	if ok, _ := s.ra.Match(p.IP, p.Zone); ok {
+		return true
+	}
+	if s.cli.Debug {
+		log.Printf("lemonade HTTP request from '%s' is not allowed", r.RemoteAddr)
+	}
+	http.Error(w, "forbidden", http.StatusForbidden)
+	return false
+}
+
+// guard checks allow list and authentication before calling handler.
+func (s *server) guard(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if !s.allowed(w, r) {
+			return
+		}
+		if len(s.cli.Secret) > 0 {
+			if err := s.authenticate(r); err != nil {
+				log.Printf("lemonade HTTP server rejected '%s': %s", r.RemoteAddr, err.Error())
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+		if s.cli.Debug {
+			log.Printf("lemonade HTTP %s '%s' from '%s'", r.Method, r.URL.Path, r.RemoteAddr)
+		}
+		h(w, r)
+	}
+}
+
+func (s *server) authenticate(r *http.Request) error {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, authScheme) {
+		return fmt.Errorf("%w: no credentials", lemon.ErrAuth)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(h, authScheme), ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("%w: malformed credentials", lemon.ErrAuth)
+	}
+	return s.auth.Verify(s.cli.Secret, parts[0], parts[1])
+}
+
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"status":  "ok",
+		"version": misc.GetVersion(),
+		"os":      runtime.GOOS,
+	})
+}
+
+func (s *server) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.allowed(w, r) {
+		return
+	}
+	if len(s.cli.Secret) == 0 {
+		http.Error(w, "authentication is not used", http.StatusNotFound)
+		return
+	}
+	n, err := s.auth.Issue()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprint(w, n)
+}
+
+func (s *server) handleClipboard(w http.ResponseWriter, r *http.Request) {
+
+	clip := lemon.NewClipboard(s.svc, peer(r))
+
+	switch r.Method {
+	case http.MethodGet:
+		var text string
+		if err := clip.Paste(struct{}{}, &text); err != nil {
+			http.Error(w, err.Error(), status(err))
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, lemon.ConvertLineEnding(text, r.URL.Query().Get("line-ending")))
+	case http.MethodPut:
+		if s.cli.MaxCopySize > 0 {
+			// let Copy report the error properly, but never read more than necessary
+			r.Body = http.MaxBytesReader(w, r.Body, int64(s.cli.MaxCopySize)+1)
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			if s.cli.MaxCopySize > 0 && len(body) > s.cli.MaxCopySize {
+				http.Error(w, fmt.Sprintf("%s: limit is %d bytes", lemon.ErrTooLarge, s.cli.MaxCopySize), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := clip.Copy(string(body), dummy); err != nil {
+			http.Error(w, err.Error(), status(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *server) handleOpen(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := lemon.JSONSize(s.cli.MaxURISize)
+	if limit > 0 {
+		// let Open report the error properly, but never read more than necessary
+		r.Body = http.MaxBytesReader(w, r.Body, int64(limit)+1)
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		if limit > 0 && len(body) > limit {
+			http.Error(w, fmt.Sprintf("%s: limit is %d bytes", lemon.ErrTooLarge, s.cli.MaxURISize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var p param.OpenParam
+	if err := json.Unmarshal(body, &p); err != nil {
+		http.Error(w, fmt.Sprintf("bad request: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	if len(p.URI) == 0 {
+		http.Error(w, "bad request: URI is empty", http.StatusBadRequest)
+		return
+	}
+	if err := lemon.NewURI(s.svc, peer(r)).Open(&p, dummy); err != nil {
+		http.Error(w, err.Error(), status(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,62 +1,245 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
-	"net/rpc"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/rupor-github/lemonade/lemon"
 )
 
-// Serve starts "lemonade" server backend.
-func Serve(c *lemon.CLI) error {
+func listenTCP(port int, keepAlive time.Duration) (net.Listener, error) {
 
-	uri := lemon.NewURI(c)
-	if err := rpc.Register(uri); err != nil {
-		return fmt.Errorf("unable to register URI rpc: %w", err)
+	lc := net.ListenConfig{KeepAlive: keepAlive}
+	l, err := lc.Listen(context.Background(), "tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("ListenTCP error: '%w'", err)
 	}
-	clip := lemon.NewClipboard(c)
-	if err := rpc.Register(clip); err != nil {
-		return fmt.Errorf("unable to register Clipboard rpc: %w", err)
+	return l, nil
+}
+
+// removeStaleSocket makes sure we could listen on path, removing socket left behind by previous server instance.
+func removeStaleSocket(path string, debug bool) error {
+
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
 	}
-	ra, err := lemon.NewRange(c.Allow)
 	if err != nil {
-		return fmt.Errorf("unable to process allowed IP ranges: %w", err)
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("'%s' exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("socket '%s' is in use by another process", path)
 	}
+	if debug {
+		log.Printf("lemonade server removing stale socket '%s'", path)
+	}
+	return os.Remove(path)
+}
 
-	addr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf(":%d", c.Port))
+func listenUnix(path, perm string, debug bool) (net.Listener, error) {
+
+	mode, err := strconv.ParseUint(perm, 8, 32)
 	if err != nil {
-		return fmt.Errorf("ResolveTCPAddr error: '%w'", err)
+		return nil, fmt.Errorf("bad socket permissions '%s': %w", perm, err)
+	}
+
+	if err := removeStaleSocket(path, debug); err != nil {
+		return nil, fmt.Errorf("unable to use socket: %w", err)
 	}
 
-	l, err := net.ListenTCP("tcp", addr)
+	restore := privateUmask()
+	l, err := net.Listen("unix", path)
+	restore()
 	if err != nil {
-		return fmt.Errorf("ListenTCP error: '%w'", err)
+		return nil, fmt.Errorf("ListenUnix error: '%w'", err)
 	}
-	defer l.Close()
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("unable to set socket permissions: %w", err)
+	}
+	return l, nil
+}
+
+type server struct {
+	cli    *lemon.CLI
+	svc    *lemon.Service
+	ra     *lemon.Range
+	tlsCfg *tls.Config
+	auth   *lemon.Challenges
+	conns  chan struct{} // limits number of concurrent connections
+}
+
+// listen prepares listener on unix socket path or TCP port, wrapping it into TLS when requested.
+func (s *server) listen(path string, port int) (net.Listener, error) {
+
+	var (
+		l   net.Listener
+		err error
+	)
+	if len(path) > 0 {
+		l, err = listenUnix(path, s.cli.SocketPerm, s.cli.Debug)
+	} else {
+		l, err = listenTCP(port, s.cli.KeepAlive)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.conns != nil {
+		l = newLimitListener(l, s.conns, s.cli.Debug)
+	}
+	if s.tlsCfg != nil {
+		l = tls.NewListener(l, s.tlsCfg)
+	}
+	return l, nil
+}
 
+func (s *server) accept(l net.Listener, codec lemon.Codec) error {
 	for {
 		conn, err := l.Accept()
 		if err != nil {
 			return fmt.Errorf("lemonade server Accept error: '%w'", err)
 		}
-		if c.Debug {
+		if s.cli.Debug {
 			log.Printf("lemonade server request from '%s'", conn.RemoteAddr())
 		}
-		go func(conn net.Conn) {
-			defer conn.Close()
-
-			if c.Debug {
-				log.Printf("lemonade server request from '%s'", conn.RemoteAddr())
-			}
-			if ra.IsConnIn(conn) {
-				c.ConnCh <- conn
-				rpc.ServeConn(conn)
-				if c.Debug {
-					log.Printf("lemonade server done with '%s'", conn.RemoteAddr())
-				}
-			}
-		}(conn)
+		go s.handle(conn, codec)
+	}
+}
+
+func (s *server) handle(conn net.Conn, codec lemon.Codec) {
+
+	defer conn.Close()
+
+	c := s.cli
+	if c.Debug {
+		log.Printf("lemonade server request from '%s'", conn.RemoteAddr())
+	}
+	if !s.ra.IsConnIn(conn) {
+		if c.Debug {
+			log.Printf("lemonade server request from '%s' is not allowed", conn.RemoteAddr())
+		}
+		return
+	}
+	if err := lemon.TLSHandshake(conn, c.HandshakeTimeout); err != nil {
+		log.Printf("lemonade server rejected '%s': %s", conn.RemoteAddr(), err.Error())
+		return
+	}
+	if len(c.Secret) > 0 {
+		if err := lemon.ServerHandshake(conn, c.Secret, c.HandshakeTimeout); err != nil {
+			log.Printf("lemonade server rejected '%s': %s", conn.RemoteAddr(), err.Error())
+			return
+		}
+	}
+	if err := s.svc.ServeConn(newIdleConn(conn, c.IdleTimeout, c.Debug), codec); err != nil {
+		log.Printf("lemonade server unable to serve '%s': %s", conn.RemoteAddr(), err.Error())
+		return
+	}
+	if c.Debug {
+		log.Printf("lemonade server done with '%s'", conn.RemoteAddr())
+	}
+}
+
+// Serve starts "lemonade" server backend.
+func Serve(c *lemon.CLI) error {
+
+	ra, err := lemon.NewRange(c.Allow, c.AllowRefresh)
+	if err != nil {
+		return fmt.Errorf("unable to process allowed IP ranges: %w", err)
+	}
+	defer ra.Close()
+	b, err := lemon.NewBackend(c)
+	if err != nil {
+		return fmt.Errorf("unable to prepare clipboard backend: %w", err)
+	}
+	if c.Debug {
+		if c.Relay {
+			log.Printf("lemonade server is running as clipboard relay, store: '%s'", c.RelayStore)
+		} else {
+			log.Printf("lemonade server is using '%s' clipboard backend", c.Backend)
+		}
+	}
+	s := &server{
+		cli:  c,
+		svc:  lemon.NewService(c, b),
+		ra:   ra,
+		auth: lemon.NewChallenges(),
+	}
+	if len(c.Policy) != 0 {
+		if err := s.svc.LoadPolicy(c.Policy); err != nil {
+			return err
+		}
+		if c.Debug {
+			log.Printf("lemonade server is using policy '%s'", c.Policy)
+		}
+	} else if c.PolicyBuiltin {
+		if err := s.svc.UseBuiltinPolicy(); err != nil {
+			return err
+		}
+		if c.Debug {
+			log.Printf("lemonade server is using built-in policy rules")
+		}
+	}
+	if c.MaxConns > 0 {
+		s.conns = make(chan struct{}, c.MaxConns)
+	}
+	if c.Debug && c.KeepAlive != 0 {
+		log.Printf("lemonade server TCP keep-alive period: %s", c.KeepAlive)
+	}
+	if c.TLS {
+		if s.tlsCfg, err = c.ServerTLSConfig(); err != nil {
+			return fmt.Errorf("unable to prepare TLS configuration: %w", err)
+		}
+	}
+
+	var path string
+	if c.IsUnixSocket() {
+		_, path = c.Endpoint()
+	}
+	l, err := s.listen(path, c.Port)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	codec := lemon.CodecGob
+	if c.JSONRPC {
+		codec = lemon.CodecAuto
+	}
+
+	defer s.svc.Close()
+	if c.HistorySize > 0 {
+		s.svc.StartMonitor()
+	}
+
+	errs := make(chan error, 3)
+	go func() { errs <- s.accept(l, codec) }()
+
+	if c.JSONRPCPort != 0 {
+		jl, err := s.listen("", c.JSONRPCPort)
+		if err != nil {
+			return err
+		}
+		defer jl.Close()
+		go func() { errs <- s.accept(jl, lemon.CodecJSON) }()
+	}
+
+	if c.HTTPPort != 0 {
+		hl, err := s.listen("", c.HTTPPort)
+		if err != nil {
+			return err
+		}
+		defer hl.Close()
+		go func() { errs <- s.serveHTTP(hl) }()
 	}
+	return <-errs
 }
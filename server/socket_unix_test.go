@@ -0,0 +1,99 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "lemonade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lemonade.sock")
+
+	// permissions are set whatever process umask is
+	old := syscall.Umask(0)
+	defer syscall.Umask(old)
+
+	for perm, mode := range map[string]os.FileMode{"0600": 0600, "0660": 0660, "0666": 0666} {
+		l, err := listenUnix(path, perm, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != mode {
+			t.Errorf("Expected socket with mode %s, but got %s", mode, fi.Mode())
+		}
+		l.Close()
+	}
+
+	if _, err := listenUnix(path, "rw", false); err == nil {
+		t.Errorf("Expected failure for bad permissions")
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "lemonade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lemonade.sock")
+
+	if err := removeStaleSocket(path, false); err != nil {
+		t.Errorf("Expected missing socket to be ignored, but got '%v'", err)
+	}
+
+	// socket in use is kept
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(path, false); err == nil {
+		t.Errorf("Expected live socket to be reported")
+	}
+	if _, err := os.Lstat(path); err != nil {
+		t.Errorf("Expected live socket to be kept, but got '%v'", err)
+	}
+	if _, err := listenUnix(path, "0600", false); err == nil {
+		t.Errorf("Expected server not to take over live socket")
+	}
+
+	// socket left behind by dead process is removed
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if _, err := os.Lstat(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(path, false); err != nil {
+		t.Errorf("Expected stale socket to be removed, but got '%v'", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected stale socket to be removed, but got '%v'", err)
+	}
+
+	// anything else is never touched
+	if err := ioutil.WriteFile(path, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(path, false); err == nil {
+		t.Errorf("Expected regular file to be reported")
+	}
+	if _, err := os.Lstat(path); err != nil {
+		t.Errorf("Expected regular file to be kept, but got '%v'", err)
+	}
+}
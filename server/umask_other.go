@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package server
+
+// There is no umask on this platform, socket permissions are only set after it is created.
+func privateUmask() func() {
+	return func() {}
+}
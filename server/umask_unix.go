@@ -0,0 +1,13 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package server
+
+import "syscall"
+
+// privateUmask makes files created until returned function is called accessible by owner only, so socket is never
+// open to others before its permissions are set. Umask is process wide, so it is only changed while socket is created.
+func privateUmask() func() {
+	old := syscall.Umask(0177)
+	return func() { syscall.Umask(old) }
+}